@@ -8,16 +8,23 @@ import (
 )
 
 func main() {
-	if err := rfkill.Each(func(ev rfkill.Event) error {
-		if ev.Soft == 0 {
+	if err := rfkill.EachDevice(func(dev rfkill.Device) error {
+		if !dev.Soft {
 			return nil
 		}
-		name, err := rfkill.NameByIdx(ev.Idx)
+		fmt.Printf("unblocking: %s\n", dev.Name)
+		if err := rfkill.BlockByIdx(dev.Idx, false); err != nil {
+			return err
+		}
+		// software cannot clear a hardware switch
+		hard, err := rfkill.HardBlockedByIdx(dev.Idx)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("unblocking: %s\n", name)
-		return rfkill.BlockByIdx(ev.Idx, false)
+		if hard {
+			fmt.Fprintf(os.Stderr, "warning: %s is still hard blocked\n", dev.Name)
+		}
+		return nil
 	}); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(1)
@@ -0,0 +1,79 @@
+package rfkill
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// The exported API is declared twice, in the linux files and in the stubs
+// of rfkill_other.go, building this list on every platform catches the two
+// drifting apart.
+var (
+	_ func() bool                                                      = Supported
+	_ func(uint32) (string, error)                                     = NameByIdx
+	_ func(string) (uint32, error)                                     = IdxByName
+	_ func(uint32) (bool, bool, error)                                 = StateByIdx
+	_ func(uint32) (bool, error)                                       = HardBlockedByIdx
+	_ func(uint32) (bool, error)                                       = PersistentByIdx
+	_ func(uint32) (Type, error)                                       = TypeByIdx
+	_ func(uint32) ([]string, error)                                   = InterfacesByIdx
+	_ func(uint32) (string, error)                                     = DevicePathByIdx
+	_ func() ([]Device, error)                                         = ListDevices
+	_ func(func(Device) error) error                                   = EachDevice
+	_ func() (map[Type]int, error)                                     = CountByType
+	_ func() ([]Type, error)                                           = PresentTypes
+	_ func() ([]Device, error)                                         = BlockedDevices
+	_ func() ([]Device, error)                                         = UnblockedDevices
+	_ func(uint32) (Device, error)                                     = GetByIdx
+	_ func(uint32, bool) error                                         = BlockByIdx
+	_ func(uint32, Type, bool) error                                   = BlockByIdxType
+	_ func(map[uint32]bool) error                                      = BlockByIdxs
+	_ func(bool, ...uint32) error                                      = BlockIndices
+	_ func(uint32) (func() error, error)                               = ScopedBlock
+	_ func(uint32, bool, bool) error                                   = SetBlock
+	_ func(uint32) error                                               = UnblockByIdx
+	_ func(uint32) error                                               = ToggleByIdx
+	_ func(bool) error                                                 = BlockAll
+	_ func(Type, bool) error                                           = BlockTypeAll
+	_ func() error                                                     = UnblockAll
+	_ func() ([]uint32, error)                                         = UnblockAllPersistent
+	_ func(Type, bool) error                                           = BlockByType
+	_ func(...Type) error                                              = BlockAllExcept
+	_ func(string, bool) error                                         = BlockByName
+	_ func(string) ([]uint32, error)                                   = Resolve
+	_ func(Event) error                                                = Write
+	_ func() ([]Event, error)                                          = Devices
+	_ func(func(Event) error) error                                    = Each
+	_ func(context.Context, func(Event) error) error                   = EachContext
+	_ func(...Op) (*Watcher, error)                                    = Watch
+	_ func(context.Context, ...Op) (*Watcher, error)                   = WatchContext
+	_ func(Filter) (*Watcher, error)                                   = WatchFilter
+	_ func(chan<- Event, ...Op) (*Watcher, error)                      = WatchInto
+	_ func(context.Context, func(Event) error, ...Op) error            = Notify
+	_ func(context.Context, ...WatchOption) (*Watcher, error)          = NewWatcher
+	_ func(*Watcher) <-chan Event                                      = (*Watcher).C
+	_ func(*Watcher) <-chan TimedEvent                                 = (*Watcher).Timed
+	_ func(*Watcher) <-chan error                                      = (*Watcher).Errors
+	_ func(*Watcher, time.Duration) ([]Event, error)                   = (*Watcher).Drain
+	_ func(*Watcher) error                                             = (*Watcher).Err
+	_ func(*Watcher, []Op, []Type)                                     = (*Watcher).SetFilter
+	_ func(*Watcher) WatchStats                                        = (*Watcher).Stats
+	_ func(*Watcher) error                                             = (*Watcher).Close
+	_ func() (*Client, error)                                          = Open
+	_ func(context.Context) (*Client, error)                           = OpenContext
+	_ func(string) (*Client, error)                                    = OpenFile
+	_ func(string, int, os.FileMode) (*Client, error)                  = OpenFileMode
+	_ func(*Client, uint32, bool) error                                = (*Client).Block
+	_ func(*Client, uint32) error                                      = (*Client).Toggle
+	_ func(*Client, Event) error                                       = (*Client).Write
+	_ func(*Client) (RawEvent, error)                                  = (*Client).ReadRaw
+	_ func(*Client, context.Context, ...WatchOption) (*Watcher, error) = (*Client).Watch
+	_ func(*Client) ([]Event, error)                                   = (*Client).DrainPending
+	_ func(*Client, time.Duration) ([]Event, error)                    = (*Client).Events
+	_ func(*Client) error                                              = (*Client).Close
+	_ func(context.Context, Type) (Event, error)                       = WaitForType
+	_ func(context.Context, uint32, ...Op) (Event, error)              = WaitForIdx
+	_ func(context.Context, Type, bool) ([]Device, error)              = BlockType
+	_ func(context.Context, bool) error                                = WaitAllBlocked
+)
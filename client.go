@@ -0,0 +1,261 @@
+//+build linux
+
+package rfkill
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Client keeps the control device open across operations.
+type Client struct {
+	file *os.File
+
+	// extended is set when the kernel is asked to send extended frames.
+	extended bool
+}
+
+// Open opens the control device for reading and writing.
+//
+// The client has to be closed when it's not needed anymore.
+func Open() (*Client, error) {
+	return openClient(controlFile, os.O_RDWR, defaultPerm)
+}
+
+// OpenContext is like Open but gives up opening the control device
+// as soon as ctx is done, ctx isn't used after it returns.
+func OpenContext(ctx context.Context) (*Client, error) {
+	f, err := openContext(ctx, controlFile, os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{file: f}, nil
+}
+
+// OpenFile is like Open but uses the named control device,
+// e.g. when it's mounted to a nonstandard path in a container.
+func OpenFile(name string) (*Client, error) {
+	return openClient(name, os.O_RDWR, defaultPerm)
+}
+
+// OpenFileMode is the generalized OpenFile that opens the named control
+// device with the given flags, e.g. O_WRONLY or O_NONBLOCK, and perm
+// that's used only when the node is created with O_CREATE,
+// O_CLOEXEC is always added.
+//
+// Reads still wait for events even with O_NONBLOCK,
+// since the runtime polls the descriptor on the caller's behalf.
+func OpenFileMode(name string, flags int, perm os.FileMode) (*Client, error) {
+	return openClient(name, flags, perm)
+}
+
+func openClient(name string, flags int, perm os.FileMode) (*Client, error) {
+	f, err := open(name, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{file: f}, nil
+}
+
+// Block soft blocks or unblocks a device by the given idx.
+func (c *Client) Block(idx uint32, block bool) error {
+	return c.write(Event{
+		Idx:  idx,
+		Op:   OpChange,
+		Soft: softState(block),
+	})
+}
+
+// Toggle inverts the soft block state of a device by the given idx.
+//
+// The current state is read from /sys/class/rfkill/rfkill{IDX}/soft.
+func (c *Client) Toggle(idx uint32) error {
+	soft, err := readBool(idx, "soft")
+	if err != nil {
+		return err
+	}
+	return c.Block(idx, !soft)
+}
+
+// Write writes an arbitrary event to the control device.
+func (c *Client) Write(ev Event) error {
+	if err := validate(ev); err != nil {
+		return err
+	}
+	return c.write(ev)
+}
+
+// write writes the given events to the control device, it doesn't stop on
+// the first failed event but returns all errors combined.
+func (c *Client) write(evs ...Event) error {
+	var errs []error
+	for _, ev := range evs {
+		if err := binary.Write(c.file, endianness, &ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// ReadRaw reads a single event queued by the kernel for the client
+// along with its whole frame, it blocks until an event is available.
+//
+// The kernel truncates frames to struct rfkill_event unless it's asked
+// for larger ones with the RFKILL_IOC_MAX_SIZE ioctl, so the first call
+// issues it on the client's descriptor to get struct rfkill_event_ext.
+// Kernels before 5.11 don't know the ioctl and send only the known fields.
+func (c *Client) ReadRaw() (RawEvent, error) {
+	if !c.extended {
+		if err := setMaxEventSize(c.file, extEventSize); err != nil {
+			return RawEvent{}, err
+		}
+		c.extended = true
+	}
+	b := make([]byte, extEventSize)
+	n, err := c.file.Read(b)
+	if err != nil {
+		return RawEvent{}, err
+	}
+	ev := RawEvent{Raw: b[:n]}
+	if err = decodeEvent(ev.Raw, &ev.Event); err != nil {
+		return RawEvent{}, err
+	}
+	return ev, nil
+}
+
+// Watch starts watching for events on the client's descriptor, so a single
+// read-write handle both delivers events and performs blocks, the watcher is
+// automatically closed when ctx is done. WithFile is ignored, reconnecting
+// reopens the control device the client was opened with.
+//
+// The watcher reads a duplicate of the descriptor that shares the kernel's
+// event queue with the client, so it's closed independently of the client.
+// The kernel reports changes made by the client to the queue as well,
+// so the watcher receives OpChange events of the client's own blocks.
+// Every queued event is delivered to only one reader, so DrainPending
+// and ReadRaw must not be used while the watcher is running.
+func (c *Client) Watch(ctx context.Context, opts ...WatchOption) (*Watcher, error) {
+	o := &watchOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.file = c.file.Name()
+
+	rc, err := c.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fd uintptr
+	var errno syscall.Errno
+	if err = rc.Control(func(cfd uintptr) {
+		fd, _, errno = syscall.Syscall(syscall.SYS_FCNTL, cfd, syscall.F_DUPFD_CLOEXEC, 0)
+	}); err != nil {
+		return nil, err
+	}
+	if errno != 0 {
+		return nil, os.NewSyscallError("fcntl", errno)
+	}
+	return newWatcher(ctx, os.NewFile(fd, o.file), o), nil
+}
+
+// DrainPending returns events queued by the kernel for the client that
+// are immediately available without blocking, e.g. ones emitted since the
+// client was opened or the last call, an empty backlog is not an error.
+//
+// Right after opening the backlog consists of OpAdd events for all registered devices.
+func (c *Client) DrainPending() ([]Event, error) {
+	rc, err := c.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var evs []Event
+	var ev Event
+	for {
+		if err = readNonblock(rc, &ev); err != nil {
+			switch err {
+			case io.EOF:
+				return evs, nil
+			case ErrTruncatedEvent:
+				continue
+			default:
+				return nil, err
+			}
+		}
+		evs = append(evs, ev)
+	}
+}
+
+// Events collects events queued by the kernel for the client that arrive
+// within d, e.g. confirmations of blocks made by the client, the deadline
+// is removed before it returns so the client can be read afterwards.
+//
+// Like DrainPending and ReadRaw it consumes the client's queue, so it's mutually
+// exclusive with them and with a watcher started with Watch, whichever
+// reads first gets an event and the others never see it.
+func (c *Client) Events(d time.Duration) ([]Event, error) {
+	if err := c.file.SetReadDeadline(time.Now().Add(d)); err != nil {
+		return nil, err
+	}
+	defer c.file.SetReadDeadline(time.Time{})
+
+	var evs []Event
+	var ev Event
+	b := make([]byte, eventSize)
+	for {
+		if err := readEvent(c.file, b, &ev); err != nil {
+			switch {
+			case os.IsTimeout(err):
+				return evs, nil
+			case err == ErrTruncatedEvent:
+				continue
+			default:
+				return nil, err
+			}
+		}
+		evs = append(evs, ev)
+	}
+}
+
+// rfkillIOCMaxSize is RFKILL_IOC_MAX_SIZE, that is _IOW('R', 2, __u32)
+// in the generic ioctl encoding used by x86 and arm.
+const rfkillIOCMaxSize = 0x40045202
+
+// setMaxEventSize sets the size frames read from f are truncated to.
+//
+// Kernels before 5.11 don't support the ioctl failing with ENOSYS,
+// later ones fail with ENOTTY for unknown ioctls, e.g. on other files,
+// both are ignored since frames are not extended then anyway.
+func setMaxEventSize(f *os.File, size uint32) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err = rc.Control(func(fd uintptr) {
+		errno = ioctl(fd, rfkillIOCMaxSize, unsafe.Pointer(&size))
+	}); err != nil {
+		return err
+	}
+	switch errno {
+	case 0, syscall.ENOTTY, syscall.ENOSYS:
+		return nil
+	default:
+		return os.NewSyscallError("ioctl", errno)
+	}
+}
+
+// ioctl issues the request on fd, it's a variable for testing purposes.
+var ioctl = func(fd, req uintptr, arg unsafe.Pointer) syscall.Errno {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	return errno
+}
+
+// Close closes the control device.
+func (c *Client) Close() error {
+	return c.file.Close()
+}
@@ -0,0 +1,329 @@
+//+build linux
+
+package rfkill
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestClient(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeAttr(t, dir, 2, "soft", "1\n")
+
+			c, err := Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if err = c.Block(1, true); err != nil {
+				t.Fatal(err)
+			}
+			if err = c.Toggle(2); err != nil {
+				t.Fatal(err)
+			}
+			got := readEvents(t, f, 2)
+			want := []Event{
+				{Idx: 1, Op: OpChange, Soft: 1},
+				{Idx: 2, Op: OpChange, Soft: 0},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("client written events = %#v, want %#v", got, want)
+			}
+		})
+	})
+}
+
+func TestOpenFile(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		name := controlFile
+		controlFile = name + ".missing"
+
+		c, err := OpenFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		if err = c.Block(1, false); err != nil {
+			t.Fatal(err)
+		}
+		want := Event{Idx: 1, Op: OpChange}
+		if got := readEvents(t, f, 1); got[0] != want {
+			t.Fatalf("client written event = %#v, want %#v", got[0], want)
+		}
+	})
+}
+
+func TestOpenFileMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// e.g. a minimal container where the node doesn't exist yet
+	name := filepath.Join(dir, "rfkill")
+	c, err := OpenFileMode(name, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err = c.Block(1, true); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("created control device mode = %s, want %s", fi.Mode().Perm(), os.FileMode(0600))
+	}
+	if _, err = OpenFileMode(name+".missing", os.O_WRONLY, 0600); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("OpenFileMode without O_CREATE err = %v, want %v", err, ErrNotExist)
+	}
+}
+
+func TestOpenFileModeNonblock(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		c, err := OpenFileMode(controlFile, os.O_RDWR|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		ev := Event{Idx: 2, Type: TypeWLAN, Op: OpAdd}
+		if err = binary.Write(f, endianness, ev); err != nil {
+			t.Fatal(err)
+		}
+		evs, err := c.DrainPending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evs) != 1 || evs[0] != ev {
+			t.Fatalf("DrainPending() = %v, want %v", evs, []Event{ev})
+		}
+	})
+}
+
+func TestClientDrainPending(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		c, err := Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		want := []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1},
+		}
+		for _, ev := range want {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		evs, err := c.DrainPending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(evs, want) {
+			t.Fatalf("DrainPending() = %v, want %v", evs, want)
+		}
+		if evs, err = c.DrainPending(); err != nil {
+			t.Fatal(err)
+		} else if len(evs) != 0 {
+			t.Fatalf("DrainPending() of empty backlog = %v, want none", evs)
+		}
+	})
+}
+
+func TestClientEvents(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		c, err := Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		if evs, err := c.Events(10 * time.Millisecond); err != nil {
+			t.Fatal(err)
+		} else if len(evs) != 0 {
+			t.Fatalf("Events() with nothing queued = %v, want none", evs)
+		}
+
+		want := []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1},
+			{Idx: 1, Type: TypeBluetooth, Op: OpChange, Soft: 1},
+		}
+		for _, ev := range want {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		evs, err := c.Events(50 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(evs, want) {
+			t.Fatalf("Events() = %v, want %v", evs, want)
+		}
+
+		// the deadline must not outlive the call
+		if err = binary.Write(f, endianness, want[0]); err != nil {
+			t.Fatal(err)
+		}
+		ev, err := c.ReadRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Event != want[0] {
+			t.Fatalf("ReadRaw() after Events = %v, want %v", ev.Event, want[0])
+		}
+	})
+}
+
+func TestClientReadRaw(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		c, err := Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		// extended frames with hard_block_reasons appended,
+		// the fifo fails the ioctl with ENOTTY that's ignored
+		var frames [][]byte
+		for _, ev := range []Event{
+			{Idx: 3, Type: TypeWLAN, Op: OpChange, Hard: 1},
+			{Idx: 4, Type: TypeBluetooth, Op: OpChange, Hard: 1},
+		} {
+			var b bytes.Buffer
+			if err = binary.Write(&b, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+			b.WriteByte(1)
+			if _, err = f.Write(b.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			frames = append(frames, b.Bytes())
+		}
+
+		for i, want := range []Event{
+			{Idx: 3, Type: TypeWLAN, Op: OpChange, Hard: 1},
+			{Idx: 4, Type: TypeBluetooth, Op: OpChange, Hard: 1},
+		} {
+			ev, err := c.ReadRaw()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.Event != want {
+				t.Fatalf("ReadRaw() event = %v, want %v", ev.Event, want)
+			}
+			if !bytes.Equal(ev.Raw, frames[i]) {
+				t.Fatalf("ReadRaw() raw = %v, want %v", ev.Raw, frames[i])
+			}
+		}
+	})
+}
+
+func TestClientReadRawMaxSize(t *testing.T) {
+	tmp := ioctl
+	defer func() {
+		ioctl = tmp
+	}()
+
+	for _, c := range []struct {
+		errno syscall.Errno
+		fails bool
+	}{
+		{0, false},
+		{syscall.ENOTTY, false},
+		{syscall.ENOSYS, false},
+		{syscall.EINVAL, true},
+	} {
+		withControlFifo(t, func(f *os.File) {
+			var n int
+			ioctl = func(fd, req uintptr, arg unsafe.Pointer) syscall.Errno {
+				n++
+				if req != rfkillIOCMaxSize {
+					t.Errorf("ioctl request = %#x, want %#x", req, rfkillIOCMaxSize)
+				}
+				if size := *(*uint32)(arg); size != extEventSize {
+					t.Errorf("ioctl size = %d, want %d", size, extEventSize)
+				}
+				return c.errno
+			}
+
+			cl, err := Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			if err = binary.Write(f, endianness, Event{Idx: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = cl.ReadRaw(); (err != nil) != c.fails {
+				t.Fatalf("ReadRaw() with ioctl %v err = %v", c.errno, err)
+			}
+			if c.fails {
+				return
+			}
+			// it's issued only once
+			if err = binary.Write(f, endianness, Event{Idx: 2}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = cl.ReadRaw(); err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Fatalf("ioctl issued %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		c, err := Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		w, err := c.Watch(context.Background(), WithOps(OpChange))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		// the fifo loops written events back like the kernel
+		// reports changes to the descriptor they're made on
+		if err = c.Block(1, true); err != nil {
+			t.Fatal(err)
+		}
+		if ev, want := <-w.C(), (Event{Idx: 1, Op: OpChange, Soft: 1}); ev != want {
+			t.Fatalf("received event = %v, want %v", ev, want)
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Block(1, false); err != nil {
+			t.Fatalf("Block after closing the watcher err = %v", err)
+		}
+	})
+}
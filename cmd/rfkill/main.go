@@ -0,0 +1,123 @@
+// Command rfkill lists, blocks and unblocks rfkill devices
+// and monitors their events similarly to the util-linux tool.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/amenzhinsky/rfkill"
+)
+
+const usage = `Usage: %s COMMAND [ARG...]
+
+Commands:
+  list                  list all devices
+  block   TYPE|ID|NAME  soft block devices
+  unblock TYPE|ID|NAME  soft unblock devices
+  event                 print events until interrupted
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0])
+	}
+	flag.Parse()
+	if err := run(flag.Args()); err != nil {
+		if err == errUsage {
+			flag.Usage()
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("invalid usage")
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "list":
+		if len(args) != 0 {
+			return errUsage
+		}
+		return list()
+	case "block", "unblock":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return block(args[0], cmd == "block")
+	case "event":
+		if len(args) != 0 {
+			return errUsage
+		}
+		return event()
+	default:
+		return errUsage
+	}
+}
+
+func list() error {
+	devs, err := rfkill.ListDevices()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tDEVICE\tSOFT\tHARD")
+	for _, dev := range devs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			dev.Idx, dev.Type, dev.Name, state(dev.Soft), state(dev.Hard))
+	}
+	return w.Flush()
+}
+
+func state(blocked bool) string {
+	if blocked {
+		return "blocked"
+	}
+	return "unblocked"
+}
+
+// block blocks devices referred by spec that is an idx, a type or a name.
+func block(spec string, blocked bool) error {
+	idxs, err := rfkill.Resolve(spec)
+	if err != nil {
+		return err
+	}
+	return rfkill.BlockIndices(blocked, idxs...)
+}
+
+func event() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		cancel()
+	}()
+
+	w, err := rfkill.WatchContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for ev := range w.C() {
+		fmt.Println(ev)
+	}
+	if err = w.Err(); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
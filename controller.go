@@ -0,0 +1,32 @@
+package rfkill
+
+// Controller is a set of rfkill operations, it lets consumers
+// replace the kernel with a fake one in tests, see the rfkilltest package.
+type Controller interface {
+	// Block changes the soft block state of the named device.
+	Block(idx uint32, block bool) error
+
+	// List returns all registered devices sorted by idx.
+	List() ([]Device, error)
+
+	// Watch starts watching for events with the given ops.
+	Watch(ops ...Op) (*Watcher, error)
+}
+
+// System is the Controller backed by the kernel,
+// its methods delegate to the package-level functions.
+var System Controller = system{}
+
+type system struct{}
+
+func (system) Block(idx uint32, block bool) error {
+	return BlockByIdx(idx, block)
+}
+
+func (system) List() ([]Device, error) {
+	return ListDevices()
+}
+
+func (system) Watch(ops ...Op) (*Watcher, error) {
+	return Watch(ops...)
+}
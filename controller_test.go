@@ -0,0 +1,41 @@
+//+build linux
+
+package rfkill
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSystem(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			dev := Device{Idx: 1, Name: "phy1", Type: TypeWLAN}
+			writeDevice(t, dir, dev)
+
+			devs, err := System.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []Device{dev}; !reflect.DeepEqual(devs, want) {
+				t.Fatalf("List() = %v, want %v", devs, want)
+			}
+
+			w, err := System.Watch(OpChange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			// the watcher reads what Block writes to the fifo
+			if err = System.Block(1, true); err != nil {
+				t.Fatal(err)
+			}
+			want := Event{Idx: 1, Op: OpChange, Soft: 1}
+			if ev := <-w.C(); ev != want {
+				t.Fatalf("received event = %v, want %v", ev, want)
+			}
+		})
+	})
+}
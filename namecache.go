@@ -0,0 +1,61 @@
+package rfkill
+
+import "sync"
+
+// NameCache caches device names returned by NameByIdx,
+// it's meant to be used in watch loops that need names of
+// devices events refer to without reading sysfs every time.
+//
+// Since indices are reused after devices are removed, every event
+// has to be passed to Observe to keep the cache consistent.
+// The zero value is ready to use and it's safe for concurrent use.
+type NameCache struct {
+	mu    sync.Mutex
+	names map[uint32]string
+
+	// gens are bumped by Observe, so a name read from sysfs
+	// concurrently with an invalidation is not cached.
+	gens map[uint32]uint64
+}
+
+// Get returns name of the named device idx,
+// it's read from sysfs only when it's not cached yet.
+func (c *NameCache) Get(idx uint32) (string, error) {
+	c.mu.Lock()
+	name, ok := c.names[idx]
+	gen := c.gens[idx]
+	c.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	name, err := NameByIdx(idx)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[idx] != gen {
+		return name, nil // the device may be already replaced
+	}
+	if c.names == nil {
+		c.names = make(map[uint32]string)
+	}
+	c.names[idx] = name
+	return name, nil
+}
+
+// Observe invalidates the cached name of the event's device
+// when it's added or removed, other events are ignored.
+func (c *NameCache) Observe(ev Event) {
+	if ev.Op != OpAdd && ev.Op != OpDel {
+		return
+	}
+	c.mu.Lock()
+	delete(c.names, ev.Idx)
+	if c.gens == nil {
+		c.gens = make(map[uint32]uint64)
+	}
+	c.gens[ev.Idx]++
+	c.mu.Unlock()
+}
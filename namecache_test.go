@@ -0,0 +1,79 @@
+//+build linux
+
+package rfkill
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestNameCache(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "name", "phy0\n")
+
+		var c NameCache
+		for _, want := range []string{"phy0", "phy0"} {
+			name, err := c.Get(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != want {
+				t.Fatalf("Get(0) = %q, want %q", name, want)
+			}
+			// the cached name has to survive the change
+			writeAttr(t, dir, 0, "name", "phy1\n")
+		}
+
+		c.Observe(Event{Idx: 0, Op: OpChange})
+		if name, _ := c.Get(0); name != "phy0" {
+			t.Fatalf("Get(0) after OpChange = %q, want %q", name, "phy0")
+		}
+		c.Observe(Event{Idx: 0, Op: OpDel})
+		if name, _ := c.Get(0); name != "phy1" {
+			t.Fatalf("Get(0) after OpDel = %q, want %q", name, "phy1")
+		}
+		if _, err := c.Get(1); err == nil {
+			t.Fatal("Get of missing device expected to fail")
+		}
+	})
+}
+
+func TestNameCacheObserveDuringGet(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "name", "phy0\n")
+
+		tmp := readFile
+		defer func() {
+			readFile = tmp
+		}()
+		reading, resume := make(chan struct{}), make(chan struct{})
+		readFile = func(name string) ([]byte, error) {
+			b, err := ioutil.ReadFile(name)
+			reading <- struct{}{}
+			<-resume
+			return b, err
+		}
+
+		var c NameCache
+		done := make(chan string)
+		go func() {
+			name, _ := c.Get(0)
+			done <- name
+		}()
+
+		// the device is replaced while the old name is being read
+		<-reading
+		writeAttr(t, dir, 0, "name", "phy1\n")
+		c.Observe(Event{Idx: 0, Op: OpDel})
+		c.Observe(Event{Idx: 0, Op: OpAdd})
+		close(resume)
+		if name := <-done; name != "phy0" {
+			t.Fatalf("Get(0) = %q, want %q", name, "phy0")
+		}
+
+		readFile = tmp
+		if name, _ := c.Get(0); name != "phy1" {
+			t.Fatalf("Get(0) after replacement = %q, want %q", name, "phy1")
+		}
+	})
+}
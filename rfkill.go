@@ -1,145 +1,344 @@
 //+build linux
 
-// This is a rfkill client library for golang, works only on linux.
-//
-// For implementation details see:
-// https://github.com/torvalds/linux/blob/master/include/uapi/linux/rfkill.h
 package rfkill
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"unsafe"
 )
 
-// Op is operation type.
-type Op uint8
-
-const (
-	// OpAdd a device is added.
-	OpAdd = iota
+// NameByIdx returns system name for the named device idx.
+//
+// The value is read from /sys/class/rfkill/rfkill{IDX}/name.
+func NameByIdx(idx uint32) (string, error) {
+	return readAttr(idx, "name")
+}
 
-	// OpDel a device is deleted.
-	OpDel
+// StateByIdx returns soft and hard block states of the named device idx.
+//
+// The values are read from /sys/class/rfkill/rfkill{IDX}/{soft,hard}.
+func StateByIdx(idx uint32) (soft, hard bool, err error) {
+	if soft, err = readBool(idx, "soft"); err != nil {
+		return false, false, err
+	}
+	if hard, err = readBool(idx, "hard"); err != nil {
+		return false, false, err
+	}
+	return soft, hard, nil
+}
 
-	// OpChange a device's state is changed.
-	OpChange
+// HardBlockedByIdx reports whether the named device idx is hard blocked,
+// e.g. by a physical switch, in that case soft unblocking doesn't turn it on.
+//
+// The value is read from /sys/class/rfkill/rfkill{IDX}/hard.
+func HardBlockedByIdx(idx uint32) (bool, error) {
+	return readBool(idx, "hard")
+}
 
-	// OpChangeAll userspace changes in all devices.
-	OpChangeAll
-)
+// PersistentByIdx reports whether the soft block state of the named
+// device idx is preserved by the driver across reboots.
+//
+// The value is read from /sys/class/rfkill/rfkill{IDX}/persistent.
+func PersistentByIdx(idx uint32) (bool, error) {
+	return readBool(idx, "persistent")
+}
 
-func (op Op) String() string {
-	switch op {
-	case OpAdd:
-		return "add"
-	case OpDel:
-		return "delete"
-	case OpChange:
-		return "change"
-	case OpChangeAll:
-		return "change-all"
-	default:
-		return ""
+// TypeByIdx returns type of the named device idx.
+//
+// The value is read from /sys/class/rfkill/rfkill{IDX}/type.
+func TypeByIdx(idx uint32) (Type, error) {
+	v, err := readAttr(idx, "type")
+	if err != nil {
+		return 0, err
 	}
+	for typ, name := range sysfsTypes {
+		if name == v {
+			return typ, nil
+		}
+	}
+	return 0, fmt.Errorf("rfkill: unknown type %q", v)
 }
 
-// Type is type of rfkill switch.
-type Type uint8
+// ListDevices returns all registered devices sorted by idx.
+//
+// Devices are read from /sys/class/rfkill/rfkill* concurrently,
+// ones that disappear while reading are skipped.
+func ListDevices() ([]Device, error) {
+	names, err := filepath.Glob(filepath.Join(sysfsPath, "rfkill*"))
+	if err != nil {
+		return nil, err
+	}
+	idxs := make([]uint32, 0, len(names))
+	for _, name := range names {
+		idx, err := strconv.ParseUint(strings.TrimPrefix(filepath.Base(name), "rfkill"), 10, 32)
+		if err != nil {
+			continue
+		}
+		idxs = append(idxs, uint32(idx))
+	}
+	sort.Slice(idxs, func(i, j int) bool {
+		return idxs[i] < idxs[j]
+	})
 
-const (
-	// TypeAll toggles all switches, useless in this library.
-	TypeAll = iota
+	// every device is read into its own slot, so the order
+	// doesn't depend on which of them is read first
+	devs := make([]Device, len(idxs))
+	errs := make([]error, len(idxs))
+	sem := make(chan struct{}, listWorkers)
+	var wg sync.WaitGroup
+	for i, idx := range idxs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, idx uint32) {
+			defer wg.Done()
+			devs[i], errs[i] = readDevice(idx)
+			<-sem
+		}(i, idx)
+	}
+	wg.Wait()
 
-	// TypeWLAN switch is on a 802.11 wireless network device.
-	TypeWLAN
+	n := 0
+	for i, err := range errs {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		devs[n] = devs[i]
+		n++
+	}
+	return devs[:n], nil
+}
 
-	// TypeBluetooth switch is on a bluetooth device.
-	TypeBluetooth
+// listWorkers is the maximum number of devices ListDevices reads
+// concurrently, it's not a constant for benchmarking purposes.
+var listWorkers = 8
 
-	// TypeUWB switch is on a ultra wideband device.
-	TypeUWB
+// CountByType returns numbers of registered devices per type,
+// types without devices are omitted.
+func CountByType() (map[Type]int, error) {
+	devs, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[Type]int)
+	for _, dev := range devs {
+		m[dev.Type]++
+	}
+	return m, nil
+}
 
-	// TypeWiMAX switch is on a WiMAX device.
-	TypeWiMAX
+// PresentTypes returns distinct types of all registered devices sorted,
+// an empty list is returned when there are no devices.
+func PresentTypes() ([]Type, error) {
+	m, err := CountByType()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]Type, 0, len(m))
+	for typ := range m {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+	return types, nil
+}
 
-	// TypeWWAN switch is on a wireless WAN device.
-	TypeWWAN
+// BlockedDevices returns devices that are either soft or hard blocked sorted by idx.
+func BlockedDevices() ([]Device, error) {
+	return filterDevices(func(dev Device) bool {
+		return dev.Soft || dev.Hard
+	})
+}
 
-	// TypeGPS switch is on a GPS device.
-	TypeGPS
+// UnblockedDevices returns devices that are neither soft
+// nor hard blocked sorted by idx.
+func UnblockedDevices() ([]Device, error) {
+	return filterDevices(func(dev Device) bool {
+		return !dev.Soft && !dev.Hard
+	})
+}
 
-	// TypeFM switch is on a FM radio device.
-	TypeFM
+func filterDevices(fn func(dev Device) bool) ([]Device, error) {
+	devs, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, dev := range devs {
+		if fn(dev) {
+			devs[n] = dev
+			n++
+		}
+	}
+	return devs[:n], nil
+}
 
-	// TypeNFC switch is on an NFC device.
-	TypeNFC
-)
+// GetByIdx returns the current state of the named device idx.
+//
+// ErrNotExist is returned when /sys/class/rfkill/rfkill{IDX} is missing.
+func GetByIdx(idx uint32) (Device, error) {
+	dev, err := readDevice(idx)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Device{}, ErrNotExist
+		}
+		return Device{}, err
+	}
+	return dev, nil
+}
 
-func (typ Type) String() string {
-	switch typ {
-	case TypeAll:
-		return "all"
-	case TypeWLAN:
-		return "wifi"
-	case TypeBluetooth:
-		return "bluetooth"
-	case TypeUWB:
-		return "uwb"
-	case TypeWiMAX:
-		return "wimax"
-	case TypeWWAN:
-		return "wwan"
-	case TypeGPS:
-		return "gps"
-	case TypeFM:
-		return "fm"
-	case TypeNFC:
-		return "nfc"
-	default:
-		return ""
+// EachDevice iterates over all registered devices read from sysfs
+// in the idx order, if fn returns an error it's immediately propagated,
+// except ErrStopIteration that stops the iteration without an error.
+func EachDevice(fn func(dev Device) error) error {
+	devs, err := ListDevices()
+	if err != nil {
+		return err
 	}
+	for _, dev := range devs {
+		if err = fn(dev); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
 }
 
-// NameByIdx returns system name for the named device idx.
+func readDevice(idx uint32) (Device, error) {
+	var err error
+	dev := Device{Idx: idx}
+	if dev.Name, err = NameByIdx(idx); err != nil {
+		return Device{}, err
+	}
+	if dev.Type, err = TypeByIdx(idx); err != nil {
+		return Device{}, err
+	}
+	if dev.Soft, dev.Hard, err = StateByIdx(idx); err != nil {
+		return Device{}, err
+	}
+	// the attribute is missing on old kernels
+	if dev.Persistent, err = PersistentByIdx(idx); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Device{}, err
+	}
+	return dev, nil
+}
+
+// InterfacesByIdx returns names of network interfaces associated
+// with the named device idx, e.g. wlan0 for a WLAN phy.
 //
-// The value is read from /sys/class/rfkill/rfkill{IDX}/name.
-func NameByIdx(idx uint32) (string, error) {
-	b, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/rfkill/rfkill%d/name", idx))
+// Interfaces are listed from /sys/class/rfkill/rfkill{IDX}/device/net
+// or the phy's parent device net directory, an empty list is returned
+// for devices that are not network ones.
+func InterfacesByIdx(idx uint32) ([]string, error) {
+	dir := deviceDir(idx)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+	for _, name := range []string{"device/net", "device/device/net"} {
+		fis, err := ioutil.ReadDir(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		names := make([]string, len(fis))
+		for i, fi := range fis {
+			names[i] = fi.Name()
+		}
+		return names, nil
+	}
+	return []string{}, nil
+}
+
+// DevicePathByIdx returns the absolute sysfs path of the physical device
+// the named device idx belongs to, that is the resolved target of
+// the /sys/class/rfkill/rfkill{IDX}/device symlink.
+//
+// Unlike indices that are reused after devices are removed the path is stable,
+// so it tells whether an idx refers to the same device as before.
+func DevicePathByIdx(idx uint32) (string, error) {
+	path, err := filepath.EvalSymlinks(filepath.Join(deviceDir(idx), "device"))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", fmt.Errorf("rfkill: idx(%d) not found in sysfs", idx)
+			return "", ErrNotExist
 		}
 		return "", err
 	}
-	return string(b), nil
+	return filepath.Abs(path)
 }
 
-// Event is a rfkill event read from /dev/rfkill.
-type Event struct {
-	// Idx is device index.
-	Idx uint32
-
-	// Type of the event.
-	Type Type
+// deviceDir returns sysfs directory of the named device idx.
+func deviceDir(idx uint32) string {
+	return filepath.Join(sysfsPath, fmt.Sprintf("rfkill%d", idx))
+}
 
-	// Op operation code.
-	Op Op
+// readAttr reads the named sysfs attribute of the device idx
+// with surrounding whitespaces trimmed, reading is retried
+// when it's interrupted by a signal.
+//
+// The whole file is read until EOF, so short reads are handled as well.
+func readAttr(idx uint32, attr string) (string, error) {
+	name := filepath.Join(deviceDir(idx), attr)
+	b, err := readFile(name)
+	for errors.Is(err, syscall.EINTR) {
+		b, err = readFile(name)
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("rfkill: idx(%d) not found in sysfs: %w", idx, err)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
 
-	// Soft state.
-	Soft uint8
+// readFile reads sysfs attributes, it's a variable for testing purposes.
+var readFile = ioutil.ReadFile
 
-	// Hard state.
-	Hard uint8
+// readBool reads a boolean 0/1 sysfs attribute of the named device idx.
+func readBool(idx uint32, attr string) (bool, error) {
+	v, err := readAttr(idx, attr)
+	if err != nil {
+		return false, err
+	}
+	switch v {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	default:
+		return false, fmt.Errorf("rfkill: unexpected %s value %q", attr, v)
+	}
 }
 
+// endianness is the native byte order, the kernel uses it for rfkill events.
 var endianness binary.ByteOrder = binary.LittleEndian
 
 func init() {
+	// {0x0, 0x1} is 1 only when the most significant byte goes first,
+	// on little-endian machines it's 256 and the default is kept
 	b := [2]byte{0x0, 0x1}
 	if *(*uint16)(unsafe.Pointer(&b[0])) == 1 {
 		endianness = binary.BigEndian
@@ -147,26 +346,392 @@ func init() {
 }
 
 // BlockByIdx soft blocks or unblocks a device by the given idx.
+//
+// Type of the event is left TypeAll that the kernel treats as
+// a wildcard matching any device, see BlockByIdxType to set it explicitly.
+//
+// It opens the control device on every call, use Client
+// to perform many operations on a single descriptor.
 func BlockByIdx(idx uint32, block bool) error {
-	f, err := open(os.O_WRONLY)
+	return write(Event{
+		Idx:  idx,
+		Op:   OpChange,
+		Soft: softState(block),
+	})
+}
+
+// BlockByIdxType soft blocks or unblocks a device by the given idx writing
+// an OpChange event with both the idx and the type set.
+//
+// The kernel uses the fields as follows:
+//
+// 	OpChange     the device with the idx is changed only when its type
+// 	             equals typ or typ is TypeAll, otherwise nothing happens
+// 	OpChangeAll  idx is ignored, all devices of the type are changed,
+// 	             use BlockTypeAll to write such events
+//
+// So a type that doesn't match the device makes the change a silent no-op,
+// that can be used as a guard against an idx reused by a different device.
+func BlockByIdxType(idx uint32, typ Type, block bool) error {
+	return write(Event{
+		Idx:  idx,
+		Type: typ,
+		Op:   OpChange,
+		Soft: softState(block),
+	})
+}
+
+// BlockByIdxs soft blocks or unblocks multiple devices at once,
+// keys are device indexes and values are states to set.
+//
+// The control device is opened only once and events are written in
+// the idx order, failed writes don't stop the rest from being attempted.
+func BlockByIdxs(m map[uint32]bool) error {
+	evs := make([]Event, 0, len(m))
+	for idx, block := range m {
+		evs = append(evs, Event{
+			Idx:  idx,
+			Op:   OpChange,
+			Soft: softState(block),
+		})
+	}
+	if len(evs) == 0 {
+		return nil
+	}
+	sort.Slice(evs, func(i, j int) bool {
+		return evs[i].Idx < evs[j].Idx
+	})
+	return write(evs...)
+}
+
+// BlockIndices soft blocks or unblocks the listed devices opening
+// the control device only once, failed writes don't stop
+// the rest from being attempted.
+//
+// Unlike BlockAll it affects only the given devices
+// and not the ones that are added later.
+func BlockIndices(block bool, idxs ...uint32) error {
+	if len(idxs) == 0 {
+		return nil
+	}
+	evs := make([]Event, len(idxs))
+	for i, idx := range idxs {
+		evs[i] = Event{
+			Idx:  idx,
+			Op:   OpChange,
+			Soft: softState(block),
+		}
+	}
+	return write(evs...)
+}
+
+// ScopedBlock soft blocks a device by the given idx and returns a function
+// that restores its previous soft block state read from sysfs beforehand,
+// so a device blocked before isn't unblocked on restore.
+//
+// Example how to turn a radio off while flashing firmware:
+//
+// 	restore, err := rfkill.ScopedBlock(idx)
+// 	if err != nil {
+// 		return err
+// 	}
+// 	defer restore()
+func ScopedBlock(idx uint32) (restore func() error, err error) {
+	soft, err := readBool(idx, "soft")
 	if err != nil {
+		return nil, err
+	}
+	if err = BlockByIdx(idx, true); err != nil {
+		return nil, err
+	}
+	return func() error {
+		if soft {
+			return nil // it was blocked already
+		}
+		return BlockByIdx(idx, false)
+	}, nil
+}
+
+// SetBlock soft blocks or unblocks a device by the given idx, when confirm
+// is true it also waits until /sys/class/rfkill/rfkill{IDX}/soft
+// reflects the requested state, failing if it doesn't within a second.
+func SetBlock(idx uint32, block, confirm bool) error {
+	if err := BlockByIdx(idx, block); err != nil {
 		return err
 	}
-	defer f.Close()
+	if !confirm {
+		return nil
+	}
+	deadline := time.Now().Add(confirmTimeout)
+	for {
+		soft, err := readBool(idx, "soft")
+		if err != nil {
+			return err
+		}
+		if soft == block {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("rfkill: idx(%d) soft state is not changed in %s", idx, confirmTimeout)
+		}
+		time.Sleep(confirmInterval)
+	}
+}
+
+// not constants for testing purposes.
+var (
+	confirmTimeout  = time.Second
+	confirmInterval = 10 * time.Millisecond
+)
+
+// UnblockByIdx soft unblocks a device by the given idx.
+func UnblockByIdx(idx uint32) error {
+	return BlockByIdx(idx, false)
+}
 
-	var soft uint8
-	if block {
-		soft = 1
+// ToggleByIdx inverts the soft block state of a device by the given idx.
+//
+// The current state is read from /sys/class/rfkill/rfkill{IDX}/soft.
+func ToggleByIdx(idx uint32) error {
+	soft, err := readBool(idx, "soft")
+	if err != nil {
+		return err
 	}
-	return binary.Write(f, endianness, &Event{
-		Idx:  idx,
-		Op:   OpChange,
-		Soft: soft,
+	return BlockByIdx(idx, !soft)
+}
+
+// BlockAll soft blocks or unblocks all devices at once with an OpChangeAll event.
+func BlockAll(block bool) error {
+	return BlockTypeAll(TypeAll, block)
+}
+
+// BlockTypeAll soft blocks or unblocks all devices of the given type
+// at once with an OpChangeAll event.
+//
+// Unlike BlockByType the kernel also remembers the state as the default
+// one for the type, so devices added later are blocked accordingly.
+func BlockTypeAll(typ Type, block bool) error {
+	return write(Event{
+		Type: typ,
+		Op:   OpChangeAll,
+		Soft: softState(block),
 	})
 }
 
+// UnblockAll soft unblocks all devices at once.
+func UnblockAll() error {
+	return BlockAll(false)
+}
+
+// UnblockAllPersistent soft unblocks all devices at once and returns
+// indices of devices whose soft block state is persistent.
+//
+// The kernel only lets userspace change the soft state, both the hard
+// state and the persistent attribute are read-only. A persistent device's
+// driver initialises its soft state from non-volatile storage on startup,
+// so such devices may come up blocked again after a reboot no matter what
+// userspace does and callers are expected to warn about them.
+func UnblockAllPersistent() ([]uint32, error) {
+	if err := UnblockAll(); err != nil {
+		return nil, err
+	}
+	devs, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	var idxs []uint32
+	for _, dev := range devs {
+		if dev.Persistent {
+			idxs = append(idxs, dev.Idx)
+		}
+	}
+	return idxs, nil
+}
+
+// BlockByType soft blocks or unblocks all currently registered devices of the given type.
+//
+// TypeAll is handled by the kernel in a single OpChangeAll event,
+// otherwise each matching device is changed separately, when some
+// writes fail the rest are still attempted and all errors are returned.
+func BlockByType(typ Type, block bool) error {
+	if typ == TypeAll {
+		return BlockAll(block)
+	}
+
+	var evs []Event
+	if err := Each(func(ev Event) error {
+		if ev.Type == typ {
+			evs = append(evs, Event{
+				Idx:  ev.Idx,
+				Type: typ,
+				Op:   OpChange,
+				Soft: softState(block),
+			})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(evs) == 0 {
+		return nil
+	}
+	return write(evs...)
+}
+
+// BlockAllExcept soft blocks all currently registered devices
+// whose type is not one of keep, devices of the kept types are
+// left untouched, they're not unblocked when they're blocked.
+// TypeAll in keep matches devices of any type, so nothing is blocked.
+//
+// Each device is blocked separately, when some writes fail
+// the rest are still attempted and all errors are returned.
+func BlockAllExcept(keep ...Type) error {
+	for _, typ := range keep {
+		if typ == TypeAll {
+			return nil
+		}
+	}
+	var evs []Event
+	if err := Each(func(ev Event) error {
+		for _, typ := range keep {
+			if ev.Type == typ {
+				return nil
+			}
+		}
+		evs = append(evs, Event{
+			Idx:  ev.Idx,
+			Type: ev.Type,
+			Op:   OpChange,
+			Soft: 1,
+		})
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(evs) == 0 {
+		return nil
+	}
+	return write(evs...)
+}
+
+// BlockByName soft blocks or unblocks all devices with the given name,
+// ErrNotExist is returned when there's no such device.
+//
+// Names are read from /sys/class/rfkill/rfkill*/name.
+func BlockByName(name string, block bool) error {
+	idxs, err := idxsByName(name)
+	if err != nil {
+		return err
+	}
+	return BlockIndices(block, idxs...)
+}
+
+// Resolve returns indices of devices referred by spec the way util-linux
+// rfkill does, that is an idx like "3", a type like "bluetooth" or
+// a device name like "phy0", in that order of precedence.
+//
+// An idx is returned as it is without checking that it's registered,
+// for a type an empty list is returned when there are no such devices
+// and for a name ErrNotExist is returned when nothing matches.
+func Resolve(spec string) ([]uint32, error) {
+	if idx, err := strconv.ParseUint(spec, 10, 32); err == nil {
+		return []uint32{uint32(idx)}, nil
+	}
+	if typ, err := ParseType(spec); err == nil {
+		devs, err := ListDevices()
+		if err != nil {
+			return nil, err
+		}
+		idxs := []uint32{}
+		for _, dev := range devs {
+			if typ == TypeAll || dev.Type == typ {
+				idxs = append(idxs, dev.Idx)
+			}
+		}
+		return idxs, nil
+	}
+	return idxsByName(spec)
+}
+
+// IdxByName returns idx of the device with the given name, it's the inverse
+// of NameByIdx. ErrNotExist is returned when there's no such device
+// and an error when the name is ambiguous, that is used by several devices.
+//
+// Names are read from /sys/class/rfkill/rfkill*/name.
+func IdxByName(name string) (uint32, error) {
+	idxs, err := idxsByName(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(idxs) != 1 {
+		return 0, fmt.Errorf("rfkill: name %q is ambiguous, devices %v have it", name, idxs)
+	}
+	return idxs[0], nil
+}
+
+// idxsByName returns indices of devices with the given name
+// sorted, ErrNotExist is returned when there's no such device.
+func idxsByName(name string) ([]uint32, error) {
+	devs, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	var idxs []uint32
+	for _, dev := range devs {
+		if dev.Name == name {
+			idxs = append(idxs, dev.Idx)
+		}
+	}
+	if len(idxs) == 0 {
+		return nil, ErrNotExist
+	}
+	return idxs, nil
+}
+
+// Write writes an arbitrary event to the control device.
+//
+// It's a low-level primitive for crafting events that
+// the higher-level helpers in this package don't cover.
+func Write(ev Event) error {
+	if err := validate(ev); err != nil {
+		return err
+	}
+	return write(ev)
+}
+
+// write writes the given events using a throwaway client.
+func write(evs ...Event) error {
+	c, err := openClient(controlFile, os.O_WRONLY, defaultPerm)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.write(evs...)
+}
+
+// Devices returns all registered devices as OpAdd events read from
+// the control device, unlike Each the whole enumeration is read
+// before returning, so the caller can process events at leisure.
+func Devices() ([]Event, error) {
+	var evs []Event
+	if err := Each(func(ev Event) error {
+		evs = append(evs, ev)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return evs, nil
+}
+
 // Each iterates over all registered devices yielding them as OpAdd events.
-// If fn returns an error the function immediately propagates it.
+// If fn returns an error the function immediately propagates it,
+// except ErrStopIteration that stops the iteration without an error.
+//
+// The end of enumeration is detected by the kernel reporting that no more
+// events are queued rather than by waiting for a quiet period, so there's
+// no timing window to tune and a slow fn can't truncate it, use EachContext
+// with a deadline to limit how long the whole enumeration may take.
 //
 // Example how to unblock all devices:
 //
@@ -176,32 +741,118 @@ func BlockByIdx(idx uint32, block bool) error {
 // 		return err
 // 	}
 func Each(fn func(ev Event) error) error {
-	w, err := Watch(OpAdd)
+	return EachContext(context.Background(), fn)
+}
+
+// EachContext is like Each but stops as soon as ctx is done returning ctx.Err().
+func EachContext(ctx context.Context, fn func(ev Event) error) error {
+	// the kernel queues OpAdd events for all registered devices on open,
+	// reading them in the nonblocking mode until EAGAIN precisely tells
+	// when the enumeration is over regardless of how slow fn is
+	f, err := open(controlFile, os.O_RDONLY|syscall.O_NONBLOCK, defaultPerm)
 	if err != nil {
 		return err
 	}
-	defer w.Close()
+	defer f.Close()
 
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ev Event
 	for {
-		select {
-		case ev, ok := <-w.C():
-			if !ok {
-				return w.Err()
-			}
-			if err = fn(ev); err != nil {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = readNonblock(rc, &ev); err != nil {
+			switch err {
+			case io.EOF:
+				return nil
+			case ErrTruncatedEvent:
+				continue
+			default:
 				return err
 			}
-			// it emulates the EAGAIN error
-		case <-time.After(time.Millisecond):
-			return nil
 		}
+		if ev.Op != OpAdd {
+			continue
+		}
+		if err = fn(ev); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// readNonblock reads an event from the given connection without
+// waiting for it, io.EOF is returned when nothing is available.
+func readNonblock(rc syscall.RawConn, ev *Event) error {
+	var b [eventSize]byte
+	var n int
+	var err error
+	if rerr := rc.Read(func(fd uintptr) bool {
+		n, err = syscall.Read(int(fd), b[:])
+		return true // never wait for the descriptor to become readable
+	}); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		if err == syscall.EAGAIN {
+			return io.EOF
+		}
+		return os.NewSyscallError("read", err)
+	}
+	if n == 0 {
+		return io.EOF
 	}
+	return decodeEvent(b[:n], ev)
+}
+
+// eventSize is size of the kernel's struct rfkill_event.
+const eventSize = 8
+
+// extEventSize is size of the kernel's struct rfkill_event_ext,
+// that is struct rfkill_event with hard_block_reasons appended since linux 5.11.
+const extEventSize = 9
+
+// Event has to be laid out exactly as struct rfkill_event.
+var _ [eventSize]byte = [unsafe.Sizeof(Event{})]byte{}
+
+// readEvent reads a single event frame from r into the scratch buffer b
+// of eventSize bytes, it's reused between calls to avoid allocations.
+func readEvent(r io.Reader, b []byte, ev *Event) error {
+	n, err := r.Read(b)
+	if err != nil {
+		return err
+	}
+	return decodeEvent(b[:n], ev)
+}
+
+// decodeEvent decodes an event frame, the kernel never splits events
+// between reads so partial frames are rejected with ErrTruncatedEvent.
+func decodeEvent(b []byte, ev *Event) error {
+	if len(b) < eventSize {
+		return ErrTruncatedEvent
+	}
+	*ev = Event{
+		Idx:  endianness.Uint32(b[0:4]),
+		Type: Type(b[4]),
+		Op:   Op(b[5]),
+		Soft: b[6],
+		Hard: b[7],
+	}
+	return nil
 }
 
 // Watch monitors the rfkill events.
 //
 // If ops is not empty it acts as a filter, otherwise it delivers everything.
 //
+// The watcher runs a goroutine that lives until it's closed, even when
+// C is never drained, so Close must always be called to release it.
+//
 // Example:
 // 	w, err := rfkill.Watch()
 // 	if err != nil {
@@ -217,103 +868,667 @@ func Each(fn func(ev Event) error) error {
 // 		return err
 // 	}
 func Watch(ops ...Op) (*Watcher, error) {
-	f, err := open(os.O_RDONLY)
+	return WatchContext(context.Background(), ops...)
+}
+
+// WatchContext is like Watch but the watcher is automatically closed
+// when ctx is done, in that case Err returns ctx.Err().
+func WatchContext(ctx context.Context, ops ...Op) (*Watcher, error) {
+	return NewWatcher(ctx, WithOps(ops...))
+}
+
+// WatchFilter is like Watch but delivers only events fn returns true for,
+// that lets combining conditions on a single watcher, e.g.:
+//
+// 	w, err := rfkill.WatchFilter(rfkill.Or(
+// 		rfkill.And(rfkill.ByType(rfkill.TypeWLAN), rfkill.ByOp(rfkill.OpAdd)),
+// 		rfkill.And(rfkill.ByType(rfkill.TypeBluetooth), rfkill.ByOp(rfkill.OpChange)),
+// 	))
+func WatchFilter(fn Filter) (*Watcher, error) {
+	return NewWatcher(context.Background(), WithFilter(fn))
+}
+
+// WatchInto is like Watch but events are sent to ch instead of C.
+//
+// The caller owns ch, the watcher never closes it, even on Close,
+// so it can be shared with other producers. C delivers no events
+// but it's still closed when the watcher stops, so it tells when
+// nothing more is going to be sent to ch and Err is set.
+// Drain doesn't work for such watchers and fails immediately.
+func WatchInto(ch chan<- Event, ops ...Op) (*Watcher, error) {
+	return NewWatcher(context.Background(), WithOps(ops...), func(o *watchOptions) {
+		o.into = ch
+	})
+}
+
+// Notify calls fn for every event with the given ops, if ops is empty all
+// events are delivered, until ctx is done or fn returns an error.
+//
+// The error returned by fn is returned to the caller except ErrStopIteration
+// that stops watching without an error, when ctx is done ctx.Err() is returned.
+func Notify(ctx context.Context, fn func(Event) error, ops ...Op) error {
+	w, err := WatchContext(ctx, ops...)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for ev := range w.C() {
+		if err = fn(ev); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return w.Err()
+}
+
+// NewWatcher creates a watcher configured with the given options,
+// the watcher is automatically closed when ctx is done.
+// When ctx is done while the control device is still being opened
+// an OpenError wrapping ctx.Err() is returned.
+//
+// Example how to monitor only bluetooth devices being added or removed:
+//
+// 	w, err := rfkill.NewWatcher(ctx,
+// 		rfkill.WithOps(rfkill.OpAdd, rfkill.OpDel),
+// 		rfkill.WithTypes(rfkill.TypeBluetooth),
+// 	)
+func NewWatcher(ctx context.Context, opts ...WatchOption) (*Watcher, error) {
+	o := &watchOptions{file: controlFile}
+	for _, opt := range opts {
+		opt(o)
+	}
+	f, err := openContext(ctx, o.file, os.O_RDONLY)
 	if err != nil {
 		return nil, err
 	}
+	return newWatcher(ctx, f, o), nil
+}
+
+// newWatcher starts watching the opened control device f, the watcher owns it.
+func newWatcher(ctx context.Context, f *os.File, o *watchOptions) *Watcher {
 	w := &Watcher{
-		file: f,
-		evch: make(chan Event),
-		done: make(chan struct{}),
+		file:  f,
+		evch:  make(chan Event, o.buffer),
+		tevch: make(chan TimedEvent, o.buffer),
+		errch: make(chan error, o.buffer),
+		done:  make(chan struct{}),
+		opts:  o,
+
+		stopped: make(chan struct{}),
+	}
+	w.out = w.evch
+	if o.into != nil {
+		w.out = o.into
+	}
+	go w.watch(o)
+	if o.idle > 0 {
+		w.sent = time.Now()
+		go w.idle(o.idle)
 	}
-	go w.watch(ops)
-	return w, nil
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				w.stop(ctx.Err())
+			case <-w.stopped:
+			}
+		}()
+	}
+	return w
 }
 
 // Watcher is a event watching instance.
 type Watcher struct {
-	err  error
-	file *os.File
-	evch chan Event
-	done chan struct{}
+	mu    sync.Mutex
+	err   error
+	file  *os.File
+	evch  chan Event
+	tevch chan TimedEvent
+	errch chan error
+	done  chan struct{}
+
+	// stopped is closed when the watcher is stopped by the caller,
+	// i.e. with Close or by ctx, unlike done that is closed by errors too.
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	// out is where events are sent to, it's either evch or
+	// a channel owned by the caller that's never closed.
+	out chan<- Event
+
+	// options, stats and time of the last
+	// delivered event are guarded by mu.
+	opts  *watchOptions
+	stats WatchStats
+	sent  time.Time
 }
 
-// ErrClosed denotes closed watcher.
-var ErrClosed = errors.New("rfkill: closed")
+func (w *Watcher) watch(o *watchOptions) {
+	defer close(w.errch)
+	send := w.send
+	if o.coalesce > 0 {
+		ch := make(chan TimedEvent)
+		defer close(ch)
+		go w.coalesce(o, ch)
+		send = func(o *watchOptions, tev TimedEvent) bool {
+			select {
+			case ch <- tev:
+				return true
+			case <-w.done:
+				return false
+			}
+		}
+	} else {
+		defer close(w.evch)
+		defer close(w.tevch)
+	}
 
-func (w *Watcher) watch(ops []Op) {
-	defer close(w.evch)
+	if o.initial && !w.sendInitial(o, send) {
+		return
+	}
 
 	var ev Event
+	b := make([]byte, eventSize)
 	for {
-		if err := binary.Read(w.file, endianness, &ev); err != nil {
+		err := readEvent(w.file, b, &ev)
+		now := time.Now()
+		if err != nil {
+			if err == ErrTruncatedEvent {
+				// the next read starts with a new frame
+				if o.errors && !w.sendErr(err) {
+					return
+				}
+				continue
+			}
 			if e, ok := err.(*os.PathError); ok && e.Timeout() {
 				return // Close caused this, ignore
 			}
+			if err == io.EOF {
+				err = ErrDeviceClosed
+			}
+			if o.retries > 0 {
+				rerr := w.reopen(o)
+				if rerr == nil {
+					if o.errors && !w.sendErr(err) {
+						return
+					}
+					continue
+				}
+				err = rerr
+			}
 			w.close(err)
 			return
 		}
-		if len(ops) != 0 {
-			var found bool
-			for _, op := range ops {
-				if op == ev.Op {
-					found = true
-					break
-				}
-			}
-			if !found {
+		ok := w.match(o, ev, false)
+		if !ok {
+			continue
+		}
+		if !send(o, TimedEvent{Event: ev, Time: now}) {
+			return
+		}
+	}
+}
+
+// sendInitial delivers events queued by the kernel when the control device
+// is opened, OpAdd events pass the filters regardless of the ops,
+// false is returned when the watcher is closed meanwhile.
+func (w *Watcher) sendInitial(o *watchOptions, send func(*watchOptions, TimedEvent) bool) bool {
+	rc, err := w.file.SyscallConn()
+	if err != nil {
+		return true // the live loop is going to fail as well
+	}
+	var ev Event
+	for {
+		if err = readNonblock(rc, &ev); err != nil {
+			if err == ErrTruncatedEvent {
 				continue
 			}
+			return true // either the backlog is over or the live loop handles the error
+		}
+		ok := w.match(o, ev, true)
+		if ok && !send(o, TimedEvent{Event: ev, Time: time.Now()}) {
+			return false
 		}
+	}
+}
+
+// sendErr delivers a non-fatal error to the consumer, false is
+// returned when the watcher is closed before it's accepted.
+func (w *Watcher) sendErr(err error) bool {
+	select {
+	case w.errch <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// match reports whether ev passes the filters and updates stats with it,
+// initial makes OpAdd events of the initial state pass the ops filter.
+// Ops and types are guarded by mu since SetFilter changes them, so only
+// they are copied under it, the filter function and the logger are called
+// without holding mu, so they may use the watcher and a slow one doesn't
+// block its other methods.
+func (w *Watcher) match(o *watchOptions, ev Event, initial bool) bool {
+	w.mu.Lock()
+	f := watchOptions{ops: o.ops, types: o.types, idxs: o.idxs, filter: o.filter}
+	w.mu.Unlock()
+
+	ok := initial && ev.Op == OpAdd && f.matchDevice(ev) || f.match(ev)
+
+	w.mu.Lock()
+	if w.stats.Ops == nil {
+		w.stats.Ops = make(map[Op]uint64)
+		w.stats.Types = make(map[Type]uint64)
+	}
+	w.stats.Total++
+	if !ok {
+		w.stats.Filtered++
+	}
+	w.stats.Ops[ev.Op]++
+	w.stats.Types[ev.Type]++
+	w.mu.Unlock()
+
+	if o.logger != nil {
+		o.logger(ev, ok)
+	}
+	return ok
+}
+
+// SetFilter replaces the ops and types filters the watcher is created with,
+// events read after it returns are filtered with the new ones, empty lists
+// match everything. Other filters are left intact.
+func (w *Watcher) SetFilter(ops []Op, types []Type) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.opts.ops = append([]Op(nil), ops...)
+	w.opts.types = append([]Type(nil), types...)
+}
+
+// send delivers the event to the consumer, false is returned
+// when the watcher is closed before it's accepted.
+func (w *Watcher) send(o *watchOptions, tev TimedEvent) bool {
+	if o.timestamps {
+		select {
+		case w.tevch <- tev:
+		case <-w.done:
+			return false
+		}
+	} else {
 		select {
-		case w.evch <- ev:
+		case w.out <- tev.Event:
+		case <-w.done:
+			return false
+		}
+	}
+	if o.idle > 0 {
+		w.mu.Lock()
+		w.sent = time.Now()
+		w.mu.Unlock()
+	}
+	return true
+}
+
+// idle closes the watcher with ErrIdleTimeout when no
+// event is delivered within the given timeout.
+func (w *Watcher) idle(timeout time.Duration) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.mu.Lock()
+			since := time.Since(w.sent)
+			w.mu.Unlock()
+			if since >= timeout {
+				w.close(ErrIdleTimeout)
+				return
+			}
+			t.Reset(timeout - since)
 		case <-w.done:
 			return
 		}
 	}
 }
 
+// coalesce holds every event received from ch for the configured window
+// before delivering it, dropping identical events received meanwhile.
+//
+// When the stream ends because of an error the held event is still
+// delivered, it's dropped only when the watcher is stopped by the caller.
+func (w *Watcher) coalesce(o *watchOptions, ch <-chan TimedEvent) {
+	defer close(w.evch)
+	defer close(w.tevch)
+
+	var pending TimedEvent
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	for {
+		select {
+		case tev, ok := <-ch:
+			if !ok {
+				if timer != nil {
+					timer.Stop()
+				}
+				if timerC != nil {
+					w.flush(o, pending)
+				}
+				return
+			}
+			if timerC != nil {
+				if tev.Event == pending.Event {
+					pending = tev
+					continue
+				}
+				timer.Stop()
+				if !w.send(o, pending) {
+					return
+				}
+			}
+			pending = tev
+			timer = time.NewTimer(o.coalesce)
+			timerC = timer.C
+		case <-timerC:
+			timerC = nil
+			if !w.send(o, pending) {
+				return
+			}
+		}
+	}
+}
+
+// flush delivers the held event after the watcher is closed by an error,
+// giving up when it's stopped by the caller meanwhile.
+func (w *Watcher) flush(o *watchOptions, tev TimedEvent) {
+	select {
+	case <-w.stopped:
+		return
+	default:
+	}
+	if o.timestamps {
+		select {
+		case w.tevch <- tev:
+		case <-w.stopped:
+		}
+	} else {
+		select {
+		case w.out <- tev.Event:
+		case <-w.stopped:
+		}
+	}
+}
+
+// reopen closes the current control device descriptor and tries to open
+// it again doubling the delay between attempts until retries are exhausted.
+func (w *Watcher) reopen(o *watchOptions) error {
+	w.mu.Lock()
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+
+	var err error
+	backoff := o.backoff
+	for i := 0; i < o.retries; i++ {
+		select {
+		case <-time.After(backoff):
+		case <-w.done:
+			return ErrClosed
+		}
+		backoff *= 2
+
+		var f *os.File
+		if f, err = open(o.file, os.O_RDONLY, defaultPerm); err != nil {
+			continue
+		}
+		w.mu.Lock()
+		select {
+		case <-w.done:
+			w.mu.Unlock()
+			f.Close()
+			return ErrClosed
+		default:
+		}
+		w.file = f
+		w.mu.Unlock()
+		return nil
+	}
+	return err
+}
+
 // C is a rfkill events stream.
 func (w *Watcher) C() <-chan Event {
 	return w.evch
 }
 
+// Timed is a rfkill events stream with receive timestamps,
+// events are delivered to it instead of C only when
+// the watcher is created with the WithTimestamps option.
+func (w *Watcher) Timed() <-chan TimedEvent {
+	return w.tevch
+}
+
+// Errors is a stream of non-fatal errors, that is truncated frames and
+// failures the watcher recovered from by reconnecting, errors are delivered
+// to it only when the watcher is created with the WithErrors option.
+//
+// It's closed when the watcher stops, the fatal error is returned by Err.
+func (w *Watcher) Errors() <-chan error {
+	return w.errch
+}
+
+// Drain collects events from C until none arrive within the timeout,
+// which is handy for confirming results of operations like BlockAll.
+//
+// When the stream gets closed collected events are returned along with Err.
+//
+// Watchers created with WatchInto or WithTimestamps deliver nothing to C,
+// so an error is returned for them instead of waiting in vain.
+func (w *Watcher) Drain(timeout time.Duration) ([]Event, error) {
+	if w.opts.into != nil || w.opts.timestamps {
+		return nil, errDrainUnavailable
+	}
+	var evs []Event
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		select {
+		case ev, ok := <-w.evch:
+			if !ok {
+				return evs, w.Err()
+			}
+			evs = append(evs, ev)
+			if !t.Stop() {
+				<-t.C
+			}
+			t.Reset(timeout)
+		case <-t.C:
+			return evs, nil
+		}
+	}
+}
+
+var errDrainUnavailable = errors.New("rfkill: events are not delivered to C, nothing to drain")
+
 // Err is the watcher's error, it makes sense to call it only after
 // the channel returned from C gets closed.
+//
+// The error is set before the stream is closed, so after C is closed
+// Err returns the final error. Err and Close are safe for concurrent use
+// with each other and with receiving from C.
+//
+// ErrClosed is returned after Close and ErrDeviceClosed
+// when the control device stops delivering events on its own.
 func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.err
 }
 
+// Stats returns counters of events read by the watcher so far,
+// including ones dropped by filters, it's safe for concurrent use.
+func (w *Watcher) Stats() WatchStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := WatchStats{
+		Total:    w.stats.Total,
+		Filtered: w.stats.Filtered,
+		Ops:      make(map[Op]uint64, len(w.stats.Ops)),
+		Types:    make(map[Type]uint64, len(w.stats.Types)),
+	}
+	for op, n := range w.stats.Ops {
+		stats.Ops[op] = n
+	}
+	for typ, n := range w.stats.Types {
+		stats.Types[typ] = n
+	}
+	return stats
+}
+
 // Close makes the watcher to stop automatically closing the events stream channel.
+//
+// It's safe to call it multiple times, subsequent calls
+// return nil without touching the control device.
 func (w *Watcher) Close() error {
-	return w.close(ErrClosed)
+	return w.stop(ErrClosed)
+}
+
+// stop closes the watcher on the caller's behalf with the given error.
+func (w *Watcher) stop(err error) error {
+	w.stopOnce.Do(func() {
+		close(w.stopped)
+	})
+	return w.close(err)
 }
 
 func (w *Watcher) close(err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	select {
 	case <-w.done:
 		return nil
 	default:
 	}
 
-	// golang abstracts nonblocking read in the runtime, the only
-	// way to work this around is set a read timeout from the past
-	_ = w.file.SetReadDeadline(time.Now())
 	w.err = err
 	close(w.done)
+	if w.file == nil {
+		return nil // reconnecting
+	}
+
+	// golang abstracts nonblocking read in the runtime, the only
+	// way to work this around is set a read timeout from the past,
+	// the pending read fails with a timeout error the watch loop ignores.
+	if err := w.file.SetReadDeadline(time.Now()); err != nil {
+		if !errors.Is(err, os.ErrNoDeadline) {
+			w.file.Close()
+			return err
+		}
+		// the file isn't pollable, e.g. the kernel doesn't support polling
+		// the node, then closing is all that can be done: the pending read
+		// keeps blocking until the next event and whatever it returns
+		// is dropped since done is already closed.
+	}
 	return w.file.Close()
 }
 
-// not a constant for testing purposes.
-var controlFile = "/dev/rfkill"
+// Supported reports whether the kernel provides rfkill, that is
+// either the control device or the sysfs class is present.
+//
+// Privileges aren't checked, so operations still may fail with ErrPermission.
+func Supported() bool {
+	for _, name := range []string{controlFile, sysfsPath} {
+		if _, err := os.Stat(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultControlFile is the kernel's control device.
+const defaultControlFile = "/dev/rfkill"
+
+// defaultPerm is permission bits the control device is created with
+// when it's opened with O_CREATE, irrelevant for an existing node.
+const defaultPerm os.FileMode = 0644
+
+// not constants for testing purposes.
+var (
+	controlFile = defaultControlFile
+	sysfsPath   = "/sys/class/rfkill"
+)
 
-func open(flags int) (*os.File, error) {
-	f, err := os.OpenFile(controlFile, flags, 0644)
+// openContext is like open but gives up as soon as ctx is done
+// returning OpenError wrapping ctx.Err(), e.g. when the device node is stuck.
+//
+// The abandoned open keeps going in background and the file
+// is closed if it eventually succeeds.
+func openContext(ctx context.Context, name string, flags int) (*os.File, error) {
+	if ctx.Done() == nil {
+		return open(name, flags, defaultPerm)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &OpenError{Path: name, Err: err}
+	}
+
+	type result struct {
+		f   *os.File
+		err error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		f, err := open(name, flags, defaultPerm)
+		resc <- result{f, err}
+	}()
+	select {
+	case res := <-resc:
+		return res.f, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-resc; res.f != nil {
+				res.f.Close()
+			}
+		}()
+		return nil, &OpenError{Path: name, Err: ctx.Err()}
+	}
+}
+
+// open opens the named control device with the given flags, e.g. O_NONBLOCK
+// for reading until EAGAIN, and perm used only when it's created.
+// The descriptor is always close-on-exec so it never leaks into executed
+// child processes.
+//
+// The default control device is required to be a character device to catch
+// misconfigured container mounts early, other paths are trusted as they are.
+func open(name string, flags int, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(name, flags|syscall.O_CLOEXEC, perm)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, errors.New("rfkill: control device is missing")
+		if e, ok := err.(*os.PathError); ok {
+			err = e.Err
+		}
+		return nil, &OpenError{Path: name, Err: err}
+	}
+	if name == defaultControlFile {
+		if err = checkCharDevice(f); err != nil {
+			f.Close()
+			return nil, &OpenError{Path: name, Err: err}
 		}
-		return nil, err
 	}
 	return f, nil
 }
+
+// checkCharDevice returns an error when f is not a character device.
+func checkCharDevice(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("not a character device (mode %s)", fi.Mode())
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+//+build !linux
+
+package rfkill
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Supported reports whether the kernel provides rfkill, always false.
+func Supported() bool {
+	return false
+}
+
+// NameByIdx returns system name for the named device idx.
+func NameByIdx(idx uint32) (string, error) {
+	return "", ErrUnsupported
+}
+
+// IdxByName returns idx of the device with the given name.
+func IdxByName(name string) (uint32, error) {
+	return 0, ErrUnsupported
+}
+
+// StateByIdx returns soft and hard block states of the named device idx.
+func StateByIdx(idx uint32) (soft, hard bool, err error) {
+	return false, false, ErrUnsupported
+}
+
+// HardBlockedByIdx reports whether the named device idx is hard blocked.
+func HardBlockedByIdx(idx uint32) (bool, error) {
+	return false, ErrUnsupported
+}
+
+// PersistentByIdx reports whether the soft block state
+// of the named device idx is preserved across reboots.
+func PersistentByIdx(idx uint32) (bool, error) {
+	return false, ErrUnsupported
+}
+
+// TypeByIdx returns type of the named device idx.
+func TypeByIdx(idx uint32) (Type, error) {
+	return 0, ErrUnsupported
+}
+
+// InterfacesByIdx returns names of network interfaces associated with the named device idx.
+func InterfacesByIdx(idx uint32) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+// DevicePathByIdx returns the absolute sysfs path of the physical device
+// the named device idx belongs to.
+func DevicePathByIdx(idx uint32) (string, error) {
+	return "", ErrUnsupported
+}
+
+// ListDevices returns all registered devices sorted by idx.
+func ListDevices() ([]Device, error) {
+	return nil, ErrUnsupported
+}
+
+// EachDevice iterates over all registered devices read from sysfs.
+func EachDevice(fn func(dev Device) error) error {
+	return ErrUnsupported
+}
+
+// CountByType returns numbers of registered devices per type.
+func CountByType() (map[Type]int, error) {
+	return nil, ErrUnsupported
+}
+
+// PresentTypes returns distinct types of all registered devices sorted.
+func PresentTypes() ([]Type, error) {
+	return nil, ErrUnsupported
+}
+
+// BlockedDevices returns devices that are either soft or hard blocked sorted by idx.
+func BlockedDevices() ([]Device, error) {
+	return nil, ErrUnsupported
+}
+
+// UnblockedDevices returns devices that are neither soft
+// nor hard blocked sorted by idx.
+func UnblockedDevices() ([]Device, error) {
+	return nil, ErrUnsupported
+}
+
+// GetByIdx returns the current state of the named device idx.
+func GetByIdx(idx uint32) (Device, error) {
+	return Device{}, ErrUnsupported
+}
+
+// BlockByIdx soft blocks or unblocks a device by the given idx.
+func BlockByIdx(idx uint32, block bool) error {
+	return ErrUnsupported
+}
+
+// BlockByIdxType soft blocks or unblocks a device by the given idx
+// writing an OpChange event with both the idx and the type set.
+func BlockByIdxType(idx uint32, typ Type, block bool) error {
+	return ErrUnsupported
+}
+
+// BlockByIdxs soft blocks or unblocks multiple devices at once.
+func BlockByIdxs(m map[uint32]bool) error {
+	return ErrUnsupported
+}
+
+// BlockIndices soft blocks or unblocks the listed devices.
+func BlockIndices(block bool, idxs ...uint32) error {
+	return ErrUnsupported
+}
+
+// ScopedBlock soft blocks a device by the given idx and returns
+// a function that restores its previous soft block state.
+func ScopedBlock(idx uint32) (restore func() error, err error) {
+	return nil, ErrUnsupported
+}
+
+// SetBlock soft blocks or unblocks a device by the given idx optionally confirming the result.
+func SetBlock(idx uint32, block, confirm bool) error {
+	return ErrUnsupported
+}
+
+// UnblockByIdx soft unblocks a device by the given idx.
+func UnblockByIdx(idx uint32) error {
+	return ErrUnsupported
+}
+
+// ToggleByIdx inverts the soft block state of a device by the given idx.
+func ToggleByIdx(idx uint32) error {
+	return ErrUnsupported
+}
+
+// BlockAll soft blocks or unblocks all devices at once.
+func BlockAll(block bool) error {
+	return ErrUnsupported
+}
+
+// BlockTypeAll soft blocks or unblocks all devices of the given type at once.
+func BlockTypeAll(typ Type, block bool) error {
+	return ErrUnsupported
+}
+
+// UnblockAll soft unblocks all devices at once.
+func UnblockAll() error {
+	return ErrUnsupported
+}
+
+// UnblockAllPersistent soft unblocks all devices at once and returns
+// indices of devices whose soft block state is persistent.
+func UnblockAllPersistent() ([]uint32, error) {
+	return nil, ErrUnsupported
+}
+
+// BlockByType soft blocks or unblocks all currently registered devices of the given type.
+func BlockByType(typ Type, block bool) error {
+	return ErrUnsupported
+}
+
+// BlockAllExcept soft blocks all currently registered devices whose type is not one of keep.
+func BlockAllExcept(keep ...Type) error {
+	return ErrUnsupported
+}
+
+// BlockByName soft blocks or unblocks all devices with the given name.
+func BlockByName(name string, block bool) error {
+	return ErrUnsupported
+}
+
+// Resolve returns indices of devices referred by spec that
+// is either an idx, a type or a device name.
+func Resolve(spec string) ([]uint32, error) {
+	return nil, ErrUnsupported
+}
+
+// Write writes an arbitrary event to the control device.
+func Write(ev Event) error {
+	return ErrUnsupported
+}
+
+// Devices returns all registered devices as OpAdd events.
+func Devices() ([]Event, error) {
+	return nil, ErrUnsupported
+}
+
+// Each iterates over all registered devices yielding them as OpAdd events.
+func Each(fn func(ev Event) error) error {
+	return ErrUnsupported
+}
+
+// EachContext is like Each but stops as soon as ctx is done.
+func EachContext(ctx context.Context, fn func(ev Event) error) error {
+	return ErrUnsupported
+}
+
+// Watch monitors the rfkill events.
+func Watch(ops ...Op) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// WatchContext is like Watch but the watcher is automatically closed when ctx is done.
+func WatchContext(ctx context.Context, ops ...Op) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// WatchFilter is like Watch but delivers only events fn returns true for.
+func WatchFilter(fn Filter) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// WatchInto is like Watch but events are sent to ch instead of C.
+func WatchInto(ch chan<- Event, ops ...Op) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// Notify calls fn for every event with the given ops
+// until ctx is done or fn returns an error.
+func Notify(ctx context.Context, fn func(Event) error, ops ...Op) error {
+	return ErrUnsupported
+}
+
+// NewWatcher creates a watcher configured with the given options.
+func NewWatcher(ctx context.Context, opts ...WatchOption) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// Watcher is a event watching instance.
+type Watcher struct{}
+
+// C is a rfkill events stream.
+func (w *Watcher) C() <-chan Event {
+	return nil
+}
+
+// Timed is a rfkill events stream with receive timestamps.
+func (w *Watcher) Timed() <-chan TimedEvent {
+	return nil
+}
+
+// Errors is a stream of non-fatal errors.
+func (w *Watcher) Errors() <-chan error {
+	return nil
+}
+
+// Drain collects events until none arrive within the timeout.
+func (w *Watcher) Drain(timeout time.Duration) ([]Event, error) {
+	return nil, ErrUnsupported
+}
+
+// Err is the watcher's error.
+func (w *Watcher) Err() error {
+	return ErrUnsupported
+}
+
+// SetFilter replaces the ops and types filters the watcher is created with.
+func (w *Watcher) SetFilter(ops []Op, types []Type) {}
+
+// Stats returns counters of events read by the watcher so far.
+func (w *Watcher) Stats() WatchStats {
+	return WatchStats{}
+}
+
+// Close makes the watcher to stop.
+func (w *Watcher) Close() error {
+	return ErrUnsupported
+}
+
+// Client keeps the control device open across operations.
+type Client struct{}
+
+// Open opens the control device for reading and writing.
+func Open() (*Client, error) {
+	return nil, ErrUnsupported
+}
+
+// OpenContext is like Open but gives up as soon as ctx is done.
+func OpenContext(ctx context.Context) (*Client, error) {
+	return nil, ErrUnsupported
+}
+
+// OpenFile is like Open but uses the named control device.
+func OpenFile(name string) (*Client, error) {
+	return nil, ErrUnsupported
+}
+
+// OpenFileMode is like OpenFile but uses the given open flags and permissions.
+func OpenFileMode(name string, flags int, perm os.FileMode) (*Client, error) {
+	return nil, ErrUnsupported
+}
+
+// Block soft blocks or unblocks a device by the given idx.
+func (c *Client) Block(idx uint32, block bool) error {
+	return ErrUnsupported
+}
+
+// Toggle inverts the soft block state of a device by the given idx.
+func (c *Client) Toggle(idx uint32) error {
+	return ErrUnsupported
+}
+
+// Write writes an arbitrary event to the control device.
+func (c *Client) Write(ev Event) error {
+	return ErrUnsupported
+}
+
+// ReadRaw reads a single event queued by the kernel for the client along with its whole frame.
+func (c *Client) ReadRaw() (RawEvent, error) {
+	return RawEvent{}, ErrUnsupported
+}
+
+// Watch starts watching for events on the client's descriptor.
+func (c *Client) Watch(ctx context.Context, opts ...WatchOption) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// DrainPending returns events queued by the kernel for the client
+// that are immediately available without blocking.
+func (c *Client) DrainPending() ([]Event, error) {
+	return nil, ErrUnsupported
+}
+
+// Events collects events queued by the kernel for the client that arrive within d.
+func (c *Client) Events(d time.Duration) ([]Event, error) {
+	return nil, ErrUnsupported
+}
+
+// Close closes the control device.
+func (c *Client) Close() error {
+	return ErrUnsupported
+}
+
+// WaitForType waits until a device of the given type is registered.
+func WaitForType(ctx context.Context, typ Type) (Event, error) {
+	return Event{}, ErrUnsupported
+}
+
+// WaitForIdx waits for the first event of the named device idx.
+func WaitForIdx(ctx context.Context, idx uint32, ops ...Op) (Event, error) {
+	return Event{}, ErrUnsupported
+}
+
+// BlockType soft blocks or unblocks all currently registered devices of
+// the given type one by one and waits until the kernel confirms every change.
+func BlockType(ctx context.Context, typ Type, block bool) ([]Device, error) {
+	return nil, ErrUnsupported
+}
+
+// WaitAllBlocked soft blocks or unblocks all devices at once and waits
+// until the kernel confirms that every registered device is in the requested state.
+func WaitAllBlocked(ctx context.Context, block bool) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,258 @@
+//+build !linux
+
+package rfkill
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUnsupported(t *testing.T) {
+	if Supported() {
+		t.Error("Supported() = true, want false")
+	}
+
+	ctx := context.Background()
+	w := &Watcher{}
+	c := &Client{}
+	for name, fn := range map[string]func() error{
+		"NameByIdx": func() error {
+			_, err := NameByIdx(0)
+			return err
+		},
+		"IdxByName": func() error {
+			_, err := IdxByName("phy0")
+			return err
+		},
+		"StateByIdx": func() error {
+			_, _, err := StateByIdx(0)
+			return err
+		},
+		"HardBlockedByIdx": func() error {
+			_, err := HardBlockedByIdx(0)
+			return err
+		},
+		"PersistentByIdx": func() error {
+			_, err := PersistentByIdx(0)
+			return err
+		},
+		"TypeByIdx": func() error {
+			_, err := TypeByIdx(0)
+			return err
+		},
+		"InterfacesByIdx": func() error {
+			_, err := InterfacesByIdx(0)
+			return err
+		},
+		"DevicePathByIdx": func() error {
+			_, err := DevicePathByIdx(0)
+			return err
+		},
+		"ListDevices": func() error {
+			_, err := ListDevices()
+			return err
+		},
+		"EachDevice": func() error {
+			return EachDevice(func(dev Device) error {
+				return nil
+			})
+		},
+		"CountByType": func() error {
+			_, err := CountByType()
+			return err
+		},
+		"PresentTypes": func() error {
+			_, err := PresentTypes()
+			return err
+		},
+		"BlockedDevices": func() error {
+			_, err := BlockedDevices()
+			return err
+		},
+		"UnblockedDevices": func() error {
+			_, err := UnblockedDevices()
+			return err
+		},
+		"GetByIdx": func() error {
+			_, err := GetByIdx(0)
+			return err
+		},
+		"BlockByIdx": func() error {
+			return BlockByIdx(0, true)
+		},
+		"BlockByIdxType": func() error {
+			return BlockByIdxType(0, TypeWLAN, true)
+		},
+		"BlockByIdxs": func() error {
+			return BlockByIdxs(map[uint32]bool{0: true})
+		},
+		"BlockIndices": func() error {
+			return BlockIndices(true, 0)
+		},
+		"ScopedBlock": func() error {
+			_, err := ScopedBlock(0)
+			return err
+		},
+		"SetBlock": func() error {
+			return SetBlock(0, true, false)
+		},
+		"UnblockByIdx": func() error {
+			return UnblockByIdx(0)
+		},
+		"ToggleByIdx": func() error {
+			return ToggleByIdx(0)
+		},
+		"BlockAll": func() error {
+			return BlockAll(true)
+		},
+		"BlockTypeAll": func() error {
+			return BlockTypeAll(TypeWLAN, true)
+		},
+		"UnblockAll": func() error {
+			return UnblockAll()
+		},
+		"UnblockAllPersistent": func() error {
+			_, err := UnblockAllPersistent()
+			return err
+		},
+		"BlockByType": func() error {
+			return BlockByType(TypeWLAN, true)
+		},
+		"BlockAllExcept": func() error {
+			return BlockAllExcept(TypeWLAN)
+		},
+		"BlockByName": func() error {
+			return BlockByName("phy0", true)
+		},
+		"Resolve": func() error {
+			_, err := Resolve("phy0")
+			return err
+		},
+		"Write": func() error {
+			return Write(Event{Op: OpChangeAll})
+		},
+		"Devices": func() error {
+			_, err := Devices()
+			return err
+		},
+		"Each": func() error {
+			return Each(func(ev Event) error {
+				return nil
+			})
+		},
+		"EachContext": func() error {
+			return EachContext(ctx, func(ev Event) error {
+				return nil
+			})
+		},
+		"Watch": func() error {
+			_, err := Watch()
+			return err
+		},
+		"WatchContext": func() error {
+			_, err := WatchContext(ctx)
+			return err
+		},
+		"WatchFilter": func() error {
+			_, err := WatchFilter(ByOp(OpAdd))
+			return err
+		},
+		"WatchInto": func() error {
+			_, err := WatchInto(make(chan Event))
+			return err
+		},
+		"NewWatcher": func() error {
+			_, err := NewWatcher(ctx)
+			return err
+		},
+		"Notify": func() error {
+			return Notify(ctx, func(ev Event) error {
+				return nil
+			})
+		},
+		"Watcher.Drain": func() error {
+			_, err := w.Drain(time.Millisecond)
+			return err
+		},
+		"Watcher.Err": func() error {
+			return w.Err()
+		},
+		"Watcher.Close": func() error {
+			return w.Close()
+		},
+		"Open": func() error {
+			_, err := Open()
+			return err
+		},
+		"OpenContext": func() error {
+			_, err := OpenContext(ctx)
+			return err
+		},
+		"OpenFile": func() error {
+			_, err := OpenFile("/dev/rfkill")
+			return err
+		},
+		"OpenFileMode": func() error {
+			_, err := OpenFileMode("/dev/rfkill", os.O_RDWR, 0)
+			return err
+		},
+		"Client.Block": func() error {
+			return c.Block(0, true)
+		},
+		"Client.Toggle": func() error {
+			return c.Toggle(0)
+		},
+		"Client.Write": func() error {
+			return c.Write(Event{Op: OpChangeAll})
+		},
+		"Client.ReadRaw": func() error {
+			_, err := c.ReadRaw()
+			return err
+		},
+		"Client.Watch": func() error {
+			_, err := c.Watch(ctx)
+			return err
+		},
+		"Client.DrainPending": func() error {
+			_, err := c.DrainPending()
+			return err
+		},
+		"Client.Events": func() error {
+			_, err := c.Events(time.Millisecond)
+			return err
+		},
+		"Client.Close": func() error {
+			return c.Close()
+		},
+		"WaitForType": func() error {
+			_, err := WaitForType(ctx, TypeAll)
+			return err
+		},
+		"WaitForIdx": func() error {
+			_, err := WaitForIdx(ctx, 0)
+			return err
+		},
+		"BlockType": func() error {
+			_, err := BlockType(ctx, TypeWLAN, true)
+			return err
+		},
+		"WaitAllBlocked": func() error {
+			return WaitAllBlocked(ctx, true)
+		},
+	} {
+		if err := fn(); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s err = %v, want %v", name, err, ErrUnsupported)
+		}
+	}
+
+	if w.C() != nil || w.Timed() != nil || w.Errors() != nil {
+		t.Error("Watcher channels are not nil")
+	}
+	w.SetFilter([]Op{OpAdd}, []Type{TypeWLAN})
+	if s := w.Stats(); s.Total != 0 || s.Filtered != 0 || s.Ops != nil || s.Types != nil {
+		t.Errorf("Stats() = %+v, want zero", s)
+	}
+}
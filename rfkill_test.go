@@ -1,12 +1,24 @@
+//+build linux
+
 package rfkill
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"syscall"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestEach(t *testing.T) {
@@ -40,6 +52,122 @@ func TestEach(t *testing.T) {
 	})
 }
 
+func TestEachStopIteration(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		for i := uint32(0); i < 3; i++ {
+			if err := binary.Write(f, endianness, Event{Idx: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var n int
+		if err := Each(func(ev Event) error {
+			n++
+			return ErrStopIteration
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("Each yielded %d events after stopping, want 1", n)
+		}
+	})
+}
+
+func TestEachSlowCallback(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		for i := uint32(0); i < 3; i++ {
+			if err := binary.Write(f, endianness, Event{Idx: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var n int
+		if err := Each(func(ev Event) error {
+			n++
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 {
+			t.Fatalf("Each yielded %d events, want 3", n)
+		}
+	})
+}
+
+func TestDevices(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		evs := []Event{
+			{Idx: 1, Type: TypeWLAN, Soft: 1},
+			{Idx: 2, Type: TypeBluetooth, Op: OpChange},
+			{Idx: 3, Type: TypeBluetooth, Hard: 1},
+		}
+		for _, ev := range evs {
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := Devices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []Event{evs[0], evs[2]}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Devices() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDevicesEAGAIN(t *testing.T) {
+	// unlike a regular file the fifo never reports EOF while
+	// its writer is open, so only EAGAIN ends the enumeration
+	withControlFifo(t, func(f *os.File) {
+		for i := uint32(0); i < 2; i++ {
+			if err := binary.Write(f, endianness, Event{Idx: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		done := make(chan struct{})
+		var evs []Event
+		var err error
+		go func() {
+			evs, err = Devices()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Devices didn't stop when no events are queued")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evs) != 2 {
+			t.Fatalf("Devices() returned %d events, want 2", len(evs))
+		}
+	})
+}
+
+func TestEachContext(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		for i := uint32(0); i < 2; i++ {
+			if err := binary.Write(f, endianness, Event{Idx: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var n int
+		if err := EachContext(ctx, func(ev Event) error {
+			n++
+			cancel()
+			return nil
+		}); err != context.Canceled {
+			t.Fatalf("EachContext err = %v, want %v", err, context.Canceled)
+		}
+		if n != 1 {
+			t.Fatalf("EachContext yielded %d events after cancellation, want 1", n)
+		}
+	})
+}
+
 func TestBlockByIdx(t *testing.T) {
 	withControlFile(t, func(f *os.File) {
 		if err := BlockByIdx(1, true); err != nil {
@@ -60,6 +188,2149 @@ func TestBlockByIdx(t *testing.T) {
 	})
 }
 
+func TestUnblockByIdx(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := UnblockByIdx(2); err != nil {
+			t.Fatal(err)
+		}
+		want := Event{Idx: 2, Op: OpChange}
+		if got := readEvents(t, f, 1)[0]; got != want {
+			t.Fatalf("UnblockByIdx written event = %#v, want %#v", got, want)
+		}
+	})
+}
+
+func TestToggleByIdx(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			// every write overwrites the control file from the beginning
+			for _, c := range []struct {
+				soft string
+				want Event
+			}{
+				{"1\n", Event{Idx: 1, Op: OpChange, Soft: 0}},
+				{"0\n", Event{Idx: 1, Op: OpChange, Soft: 1}},
+			} {
+				writeAttr(t, dir, 1, "soft", c.soft)
+				if err := ToggleByIdx(1); err != nil {
+					t.Fatal(err)
+				}
+				if got := readEvents(t, f, 1)[0]; got != c.want {
+					t.Fatalf("ToggleByIdx with soft=%q written event = %#v, want %#v",
+						c.soft, got, c.want)
+				}
+			}
+
+			if err := ToggleByIdx(2); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("ToggleByIdx of missing device err = %v, want not exist", err)
+			}
+		})
+	})
+}
+
+func TestBlockByIdxType(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		write func() error
+		want  Event
+	}{
+		{
+			"change any type",
+			func() error { return BlockByIdxType(0, TypeAll, true) },
+			Event{Idx: 0, Type: TypeAll, Op: OpChange, Soft: 1},
+		},
+		{
+			"change wlan",
+			func() error { return BlockByIdxType(1, TypeWLAN, false) },
+			Event{Idx: 1, Type: TypeWLAN, Op: OpChange},
+		},
+		{
+			"change bluetooth",
+			func() error { return BlockByIdxType(2, TypeBluetooth, true) },
+			Event{Idx: 2, Type: TypeBluetooth, Op: OpChange, Soft: 1},
+		},
+		{
+			"change nfc",
+			func() error { return BlockByIdxType(3, TypeNFC, false) },
+			Event{Idx: 3, Type: TypeNFC, Op: OpChange},
+		},
+		{
+			"change all of any type",
+			func() error { return BlockTypeAll(TypeAll, true) },
+			Event{Type: TypeAll, Op: OpChangeAll, Soft: 1},
+		},
+		{
+			"change all wlan",
+			func() error { return BlockTypeAll(TypeWLAN, false) },
+			Event{Type: TypeWLAN, Op: OpChangeAll},
+		},
+		{
+			// the kernel ignores idx, so it's written as it is
+			"change all with idx",
+			func() error { return Write(Event{Idx: 5, Type: TypeWWAN, Op: OpChangeAll, Soft: 1}) },
+			Event{Idx: 5, Type: TypeWWAN, Op: OpChangeAll, Soft: 1},
+		},
+	} {
+		withControlFile(t, func(f *os.File) {
+			if err := c.write(); err != nil {
+				t.Fatalf("%s: %s", c.name, err)
+			}
+			if got := readEvents(t, f, 1)[0]; got != c.want {
+				t.Errorf("%s: written event = %v, want %v", c.name, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBlockByIdxs(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := BlockByIdxs(map[uint32]bool{3: false, 1: true}); err != nil {
+			t.Fatal(err)
+		}
+		got := readEvents(t, f, 2)
+		want := []Event{
+			{Idx: 1, Op: OpChange, Soft: 1},
+			{Idx: 3, Op: OpChange, Soft: 0},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("BlockByIdxs written events = %#v, want %#v", got, want)
+		}
+	})
+}
+
+func TestMultiError(t *testing.T) {
+	oerr := &OpenError{Path: "/dev/rfkill", Err: syscall.ENOENT}
+	err := multiError{errors.New("rfkill: write failed"), oerr}
+
+	// the methods are called directly since errors.Is and errors.As
+	// inspect multiple wrapped errors by themselves since go1.20
+	if !err.Is(ErrNotExist) {
+		t.Errorf("Is(%v) = false, want true", ErrNotExist)
+	}
+	if err.Is(ErrPermission) {
+		t.Errorf("Is(%v) = true, want false", ErrPermission)
+	}
+	var target *OpenError
+	if !err.As(&target) || target != oerr {
+		t.Errorf("As(*OpenError) = %v, want %v", target, oerr)
+	}
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("errors.Is(%v) = false, want true", ErrNotExist)
+	}
+}
+
+func TestSetBlock(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeAttr(t, dir, 1, "soft", "0\n")
+			writeAttr(t, dir, 1, "soft.new", "1\n")
+			go func() {
+				// emulate the kernel updating the state atomically
+				time.Sleep(20 * time.Millisecond)
+				os.Rename(
+					filepath.Join(dir, "rfkill1", "soft.new"),
+					filepath.Join(dir, "rfkill1", "soft"),
+				)
+			}()
+			if err := SetBlock(1, true, true); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+}
+
+func TestSetBlockNotConfirmed(t *testing.T) {
+	tmp := confirmTimeout
+	confirmTimeout = 20 * time.Millisecond
+	defer func() {
+		confirmTimeout = tmp
+	}()
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeAttr(t, dir, 1, "soft", "0\n")
+			if err := SetBlock(1, true, true); err == nil {
+				t.Fatal("SetBlock expected to fail")
+			}
+		})
+	})
+}
+
+func TestBlockIndices(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := BlockIndices(true, 4, 2); err != nil {
+			t.Fatal(err)
+		}
+		got := readEvents(t, f, 2)
+		want := []Event{
+			{Idx: 4, Op: OpChange, Soft: 1},
+			{Idx: 2, Op: OpChange, Soft: 1},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("BlockIndices written events = %#v, want %#v", got, want)
+		}
+	})
+}
+
+func TestScopedBlock(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+			writeDevice(t, dir, Device{Idx: 1, Name: "phy1", Type: TypeWLAN, Soft: true})
+			// every write starts at the beginning of the control file
+			for idx, want := range map[uint32]Event{
+				0: {Idx: 0, Op: OpChange},
+				1: {Idx: 1, Op: OpChange, Soft: 1},
+			} {
+				restore, err := ScopedBlock(idx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				blocked := Event{Idx: idx, Op: OpChange, Soft: 1}
+				if got := readEvents(t, f, 1)[0]; got != blocked {
+					t.Fatalf("ScopedBlock written event = %v, want %v", got, blocked)
+				}
+				if err = restore(); err != nil {
+					t.Fatal(err)
+				}
+				if got := readEvents(t, f, 1)[0]; got != want {
+					t.Fatalf("restore written event = %v, want %v", got, want)
+				}
+			}
+			if _, err := ScopedBlock(2); err == nil {
+				t.Fatal("ScopedBlock of missing device expected to fail")
+			}
+		})
+	})
+}
+
+func TestBlockAll(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := BlockAll(true); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []byte{0, 0, 0, 0, TypeAll, OpChangeAll, 1, 0}
+		if !bytes.Equal(b, want) {
+			t.Fatalf("BlockAll written bytes = %v, want %v", b, want)
+		}
+	})
+}
+
+func TestUnblockAll(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := UnblockAll(); err != nil {
+			t.Fatal(err)
+		}
+		want := Event{Type: TypeAll, Op: OpChangeAll}
+		if got := readEvents(t, f, 1)[0]; got != want {
+			t.Fatalf("UnblockAll written event = %#v, want %#v", got, want)
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		devs := []Device{
+			{Idx: 0, Name: "phy0", Type: TypeWLAN, Soft: true},
+			{Idx: 3, Name: "hci0", Type: TypeBluetooth, Hard: true},
+		}
+		for _, dev := range devs {
+			writeDevice(t, dir, dev)
+		}
+		m, err := Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[uint32]Device{0: devs[0], 3: devs[1]}
+		if !reflect.DeepEqual(m, want) {
+			t.Fatalf("Snapshot() = %v, want %v", m, want)
+		}
+	})
+}
+
+func TestUnblockAllPersistent(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN, Persistent: true})
+			writeDevice(t, dir, Device{Idx: 1, Name: "hci0", Type: TypeBluetooth})
+			writeDevice(t, dir, Device{Idx: 2, Name: "phy2", Type: TypeWLAN, Persistent: true})
+
+			idxs, err := UnblockAllPersistent()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []uint32{0, 2}; !reflect.DeepEqual(idxs, want) {
+				t.Fatalf("UnblockAllPersistent() = %v, want %v", idxs, want)
+			}
+			got := readEvents(t, f, 1)
+			if want := (Event{Op: OpChangeAll}); got[0] != want {
+				t.Fatalf("UnblockAllPersistent written event = %#v, want %#v", got[0], want)
+			}
+		})
+	})
+}
+
+func TestBlockTypeAll(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := BlockTypeAll(TypeWWAN, true); err != nil {
+			t.Fatal(err)
+		}
+		got := readEvents(t, f, 1)
+		want := Event{Type: TypeWWAN, Op: OpChangeAll, Soft: 1}
+		if !reflect.DeepEqual(got[0], want) {
+			t.Fatalf("BlockTypeAll written event = %#v, want %#v", got[0], want)
+		}
+	})
+}
+
+func TestBlockByType(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		for _, ev := range []Event{
+			{Idx: 1, Type: TypeWLAN},
+			{Idx: 2, Type: TypeBluetooth},
+			{Idx: 3, Type: TypeWLAN},
+		} {
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := BlockByType(TypeWLAN, true); err != nil {
+			t.Fatal(err)
+		}
+		got := readEvents(t, f, 2)
+		want := []Event{
+			{Idx: 1, Type: TypeWLAN, Op: OpChange, Soft: 1},
+			{Idx: 3, Type: TypeWLAN, Op: OpChange, Soft: 1},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("BlockByType written events = %#v, want %#v", got, want)
+		}
+	})
+}
+
+func TestBlockByTypeNoDevices(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		ev := Event{Idx: 1, Type: TypeWLAN}
+		if err := binary.Write(f, endianness, ev); err != nil {
+			t.Fatal(err)
+		}
+		if err := BlockByType(TypeBluetooth, true); err != nil {
+			t.Fatal(err)
+		}
+		if got := readEvents(t, f, 1); !reflect.DeepEqual(got[0], ev) {
+			t.Fatalf("BlockByType modified control file, got = %#v", got[0])
+		}
+	})
+}
+
+func TestBlockByTypeAll(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := BlockByType(TypeAll, false); err != nil {
+			t.Fatal(err)
+		}
+		got := readEvents(t, f, 1)
+		want := Event{Type: TypeAll, Op: OpChangeAll}
+		if !reflect.DeepEqual(got[0], want) {
+			t.Fatalf("BlockByType written event = %#v, want %#v", got[0], want)
+		}
+	})
+}
+
+func TestBlockAllExcept(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		for _, ev := range []Event{
+			{Idx: 1, Type: TypeWLAN, Soft: 1},
+			{Idx: 2, Type: TypeBluetooth},
+			{Idx: 3, Type: TypeWWAN},
+			{Idx: 4, Type: TypeNFC},
+		} {
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := BlockAllExcept(TypeWLAN, TypeNFC); err != nil {
+			t.Fatal(err)
+		}
+		got := readEvents(t, f, 2)
+		want := []Event{
+			{Idx: 2, Type: TypeBluetooth, Op: OpChange, Soft: 1},
+			{Idx: 3, Type: TypeWWAN, Op: OpChange, Soft: 1},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("BlockAllExcept written events = %#v, want %#v", got, want)
+		}
+	})
+
+	// keeping TypeAll keeps every device, so the control file is intact
+	withControlFile(t, func(f *os.File) {
+		want := Event{Idx: 1, Type: TypeWLAN}
+		if err := binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		if err := BlockAllExcept(TypeBluetooth, TypeAll); err != nil {
+			t.Fatal(err)
+		}
+		if got := readEvents(t, f, 1); got[0] != want {
+			t.Fatalf("BlockAllExcept(TypeAll) written event = %#v, want none", got[0])
+		}
+	})
+}
+
+func TestWatchContext(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w, err := WatchContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		want := Event{Idx: 1, Type: TypeWLAN, Op: OpAdd}
+		if err = binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %#v, want %#v", ev, want)
+		}
+		cancel()
+		for range w.C() {
+		}
+		if err = w.Err(); err != context.Canceled {
+			t.Fatalf("Err() = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestWatcherCloseTwice(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("second Close() err = %v, want nil", err)
+		}
+		for range w.C() {
+		}
+		if err = w.Err(); err != ErrClosed {
+			t.Fatalf("Err() = %v, want %v", err, ErrClosed)
+		}
+	})
+}
+
+func TestWatcherCloseUndrained(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		n := runtime.NumGoroutine()
+		w, err := Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = binary.Write(f, endianness, Event{Idx: 1}); err != nil {
+			t.Fatal(err)
+		}
+		// let the watcher read the event and park on sending it
+		time.Sleep(10 * time.Millisecond)
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; runtime.NumGoroutine() > n; i++ {
+			if i == 100 {
+				t.Fatalf("goroutines = %d after Close, want %d", runtime.NumGoroutine(), n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
+
+func TestWatcherConcurrentClose(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for range w.C() {
+			}
+			if err := w.Err(); err != ErrClosed {
+				t.Errorf("Err() = %v, want %v", err, ErrClosed)
+			}
+		}()
+		for i := uint32(0); i < 10; i++ {
+			if err = binary.Write(f, endianness, Event{Idx: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go w.Close()
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+	})
+}
+
+func TestWatcherDrain(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		want := []Event{{Idx: 0, Op: OpChange}, {Idx: 1, Op: OpChange}}
+		for _, ev := range want {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		evs, err := w.Drain(50 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(evs, want) {
+			t.Fatalf("Drain = %#v, want %#v", evs, want)
+		}
+	})
+}
+
+func TestWatcherDrainUnavailable(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := WatchInto(make(chan Event, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		if _, err = w.Drain(time.Second); err != errDrainUnavailable {
+			t.Fatalf("Drain of WatchInto err = %v, want %v", err, errDrainUnavailable)
+		}
+
+		tw, err := NewWatcher(context.Background(), WithTimestamps())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tw.Close()
+		if _, err = tw.Drain(time.Second); err != errDrainUnavailable {
+			t.Fatalf("Drain of WithTimestamps err = %v, want %v", err, errDrainUnavailable)
+		}
+	})
+}
+
+func TestNewWatcherWithTypes(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(),
+			WithOps(OpAdd),
+			WithTypes(TypeBluetooth, TypeNFC),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		for _, ev := range []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeBluetooth, Op: OpChange},
+			{Idx: 2, Type: TypeBluetooth, Op: OpAdd},
+		} {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := Event{Idx: 2, Type: TypeBluetooth, Op: OpAdd}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %#v, want %#v", ev, want)
+		}
+	})
+}
+
+func TestNewWatcherWithIdx(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithIdx(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		for _, idx := range []uint32{2, 1, 0} {
+			if err = binary.Write(f, endianness, Event{Idx: idx}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ev := <-w.C(); ev.Idx != 0 {
+			t.Fatalf("received event idx = %d, want 0", ev.Idx)
+		}
+	})
+}
+
+func TestNewWatcherWithFile(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		name := controlFile
+		controlFile = filepath.Join(filepath.Dir(name), "missing")
+
+		w, err := NewWatcher(context.Background(), WithFile(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		want := Event{Idx: 1, Op: OpAdd}
+		if err = binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %#v, want %#v", ev, want)
+		}
+	})
+}
+
+func TestNewWatcherWithTimestamps(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithTimestamps())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		want := Event{Idx: 1, Op: OpAdd}
+		before := time.Now()
+		if err = binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		tev := <-w.Timed()
+		if tev.Event != want {
+			t.Fatalf("received event = %#v, want %#v", tev.Event, want)
+		}
+		if tev.Time.Before(before) || tev.Time.After(time.Now()) {
+			t.Fatalf("received event time %s is out of range", tev.Time)
+		}
+	})
+}
+
+func TestNewWatcherWithReconnect(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithReconnect(3, time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		// closing the only writer makes the watcher to hit EOF
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if f, err = os.OpenFile(controlFile, os.O_RDWR, 0); err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		want := Event{Idx: 1, Op: OpAdd}
+		if err = binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %#v, want %#v", ev, want)
+		}
+	})
+}
+
+func TestNewWatcherWithReconnectExhausted(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithReconnect(2, time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		if err = os.Remove(controlFile); err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for range w.C() {
+		}
+		if err = w.Err(); !errors.Is(err, ErrNotExist) {
+			t.Fatalf("Err() = %v, want %v", err, ErrNotExist)
+		}
+	})
+}
+
+func TestWatcherCloseUnblocksRead(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		for i := 0; i < 100; i++ {
+			w, err := Watch()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// nothing is written, so the watcher is blocked reading
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case _, ok := <-w.C():
+				if ok {
+					t.Fatal("received an event after Close")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Close didn't interrupt the pending read")
+			}
+		}
+	})
+}
+
+func TestNewWatcherWithIdleTimeout(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithIdleTimeout(100*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		start := time.Now()
+		time.Sleep(40 * time.Millisecond)
+		if err = binary.Write(f, endianness, Event{Idx: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := <-w.C(); !ok {
+			t.Fatalf("stream closed before the event, Err() = %v", w.Err())
+		}
+		for range w.C() {
+		}
+		if err = w.Err(); err != ErrIdleTimeout {
+			t.Fatalf("Err() = %v, want %v", err, ErrIdleTimeout)
+		}
+		// the delivered event restarts the timeout
+		if d := time.Since(start); d < 130*time.Millisecond {
+			t.Fatalf("stream closed after %s, expected the timeout to restart", d)
+		}
+	})
+}
+
+func TestWatcherDeviceClosed(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		w, err := Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		for range w.C() {
+		}
+		if err = w.Err(); err != ErrDeviceClosed {
+			t.Fatalf("Err() = %v, want %v", err, ErrDeviceClosed)
+		}
+	})
+}
+
+func BenchmarkWatcher(b *testing.B) {
+	withControlFifo(b, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithOps(OpChange))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer w.Close()
+
+		// write events in large chunks so the writer isn't the bottleneck
+		var buf bytes.Buffer
+		for i := 0; i < 512; i++ {
+			if err = binary.Write(&buf, endianness, Event{Idx: uint32(i), Op: OpChange}); err != nil {
+				b.Fatal(err)
+			}
+		}
+		errc := make(chan error, 1)
+		go func() {
+			for n := 0; n < b.N; n += 512 {
+				if _, err := f.Write(buf.Bytes()); err != nil {
+					errc <- err
+					return
+				}
+			}
+			errc <- nil
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, ok := <-w.C(); !ok {
+				b.Fatal(w.Err())
+			}
+		}
+		b.StopTimer()
+		if err = <-errc; err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func TestWatchFilter(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := WatchFilter(Or(
+			And(ByType(TypeWLAN), ByOp(OpAdd)),
+			And(ByType(TypeBluetooth), ByOp(OpChange)),
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		for _, ev := range []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeBluetooth, Op: OpAdd},
+			{Idx: 0, Type: TypeWLAN, Op: OpChange},
+			{Idx: 1, Type: TypeBluetooth, Op: OpChange},
+		} {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		evs, err := w.Drain(50 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeBluetooth, Op: OpChange},
+		}
+		if !reflect.DeepEqual(evs, want) {
+			t.Fatalf("received events = %v, want %v", evs, want)
+		}
+	})
+}
+
+func TestWatchInto(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		ch := make(chan Event, 2)
+		w, err := WatchInto(ch, OpChange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		for _, ev := range []Event{
+			{Idx: 0, Op: OpAdd},
+			{Idx: 1, Op: OpChange},
+		} {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		select {
+		case ev := <-ch:
+			if want := (Event{Idx: 1, Op: OpChange}); ev != want {
+				t.Fatalf("received event = %v, want %v", ev, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no event received")
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := <-w.C(); ok {
+			t.Fatal("C() delivered an event")
+		}
+		select {
+		case ch <- Event{}: // ch is still open
+		default:
+			t.Fatal("ch is not writable after Close")
+		}
+	})
+}
+
+func TestNewWatcherWithInitialState(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		// the backlog queued before the watcher is started
+		for _, ev := range []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeBluetooth, Op: OpAdd},
+			{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1},
+		} {
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w, err := NewWatcher(context.Background(),
+			WithInitialState(), WithOps(OpChange), WithTypes(TypeWLAN),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		evs, err := w.Drain(50 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1},
+		}
+		if !reflect.DeepEqual(evs, want) {
+			t.Fatalf("received events = %v, want %v", evs, want)
+		}
+	})
+}
+
+func TestWatcherSetFilter(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := Watch(OpAdd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		want := Event{Idx: 0, Type: TypeWLAN, Op: OpAdd}
+		if err = binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %v, want %v", ev, want)
+		}
+
+		w.SetFilter([]Op{OpChange}, []Type{TypeBluetooth})
+		for _, ev := range []Event{
+			{Idx: 1, Type: TypeBluetooth, Op: OpAdd},
+			{Idx: 0, Type: TypeWLAN, Op: OpChange},
+			{Idx: 1, Type: TypeBluetooth, Op: OpChange},
+		} {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want = Event{Idx: 1, Type: TypeBluetooth, Op: OpChange}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %v, want %v", ev, want)
+		}
+	})
+}
+
+func TestWatchFilterUsesWatcher(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		wc := make(chan *Watcher, 1)
+		var fw *Watcher // accessed only in the watcher's goroutine
+		w, err := NewWatcher(context.Background(), WithFilter(func(ev Event) bool {
+			if fw == nil {
+				fw = <-wc
+			}
+			// none of them may deadlock the watcher
+			_ = fw.Stats()
+			_ = fw.Err()
+			fw.SetFilter(nil, nil)
+			return ev.Idx == 1
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		wc <- w
+
+		for _, ev := range []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeWLAN, Op: OpAdd},
+		} {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		select {
+		case ev := <-w.C():
+			if ev.Idx != 1 {
+				t.Fatalf("received event = %v, want idx 1", ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("watcher is deadlocked by the filter")
+		}
+	})
+}
+
+func TestWatcherStats(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := Watch(OpChange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		for _, ev := range []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeBluetooth, Op: OpAdd},
+			{Idx: 0, Type: TypeWLAN, Op: OpChange},
+		} {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		<-w.C()
+		want := WatchStats{
+			Total:    3,
+			Filtered: 2,
+			Ops:      map[Op]uint64{OpAdd: 2, OpChange: 1},
+			Types:    map[Type]uint64{TypeWLAN: 2, TypeBluetooth: 1},
+		}
+		if stats := w.Stats(); !reflect.DeepEqual(stats, want) {
+			t.Fatalf("Stats() = %+v, want %+v", stats, want)
+		}
+	})
+}
+
+func TestWithLogger(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		type logged struct {
+			ev        Event
+			delivered bool
+		}
+		logc := make(chan logged, 3)
+		w, err := NewWatcher(context.Background(), WithOps(OpChange), WithLogger(func(ev Event, delivered bool) {
+			logc <- logged{ev, delivered}
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		evs := []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeBluetooth, Op: OpDel},
+			{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1},
+		}
+		for _, ev := range evs {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ev := <-w.C(); ev != evs[2] {
+			t.Fatalf("delivered event = %v, want %v", ev, evs[2])
+		}
+		for i, ev := range evs {
+			want := logged{ev, ev.Op == OpChange}
+			if got := <-logc; got != want {
+				t.Fatalf("logged event #%d = %+v, want %+v", i, got, want)
+			}
+		}
+	})
+}
+
+func TestNotify(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		for _, ev := range []Event{
+			{Idx: 0, Op: OpAdd},
+			{Idx: 1, Op: OpChange},
+			{Idx: 2, Op: OpChange},
+		} {
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		errStop := errors.New("stop")
+		var got []uint32
+		if err := Notify(context.Background(), func(ev Event) error {
+			got = append(got, ev.Idx)
+			if ev.Idx == 2 {
+				return errStop
+			}
+			return nil
+		}, OpChange); err != errStop {
+			t.Fatalf("Notify() err = %v, want %v", err, errStop)
+		}
+		if want := []uint32{1, 2}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("notified idxs = %v, want %v", got, want)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := Notify(ctx, func(ev Event) error {
+			return nil
+		}); err != context.DeadlineExceeded {
+			t.Fatalf("Notify() err = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestNewWatcherWithCoalesce(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithCoalesce(50*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		change := Event{Idx: 1, Op: OpChange, Soft: 1}
+		for _, ev := range []Event{change, change, change, {Idx: 2, Op: OpChange}} {
+			if err = binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		evs, err := w.Drain(100 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []Event{change, {Idx: 2, Op: OpChange}}; !reflect.DeepEqual(evs, want) {
+			t.Fatalf("received events = %#v, want %#v", evs, want)
+		}
+	})
+}
+
+func TestNewWatcherWithCoalesceDeviceClosed(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		// the event is held when the stream ends with EOF
+		want := Event{Idx: 1, Op: OpChange, Soft: 1}
+		if err := binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		w, err := NewWatcher(context.Background(), WithCoalesce(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		var evs []Event
+		for ev := range w.C() {
+			evs = append(evs, ev)
+		}
+		if !reflect.DeepEqual(evs, []Event{want}) {
+			t.Fatalf("received events = %#v, want %#v", evs, []Event{want})
+		}
+		if err = w.Err(); err != ErrDeviceClosed {
+			t.Fatalf("Err() = %v, want %v", err, ErrDeviceClosed)
+		}
+	})
+}
+
+func TestNewWatcherWithCoalesceClose(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithCoalesce(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = binary.Write(f, endianness, Event{Idx: 1, Op: OpChange}); err != nil {
+			t.Fatal(err)
+		}
+		waitRead(t, f)
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// the held event is dropped when the caller stops the watcher
+		for ev := range w.C() {
+			t.Fatalf("received %v after Close", ev)
+		}
+	})
+}
+
+func TestNewWatcherWithBuffer(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		const n = 16
+		w, err := NewWatcher(context.Background(), WithBuffer(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		for i := uint32(0); i < n; i++ {
+			if err = binary.Write(f, endianness, Event{Idx: i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// wait for the buffer to get filled without the consumer
+		for len(w.C()) != n {
+			time.Sleep(time.Millisecond)
+		}
+		for i := uint32(0); i < n; i++ {
+			if ev := <-w.C(); ev.Idx != i {
+				t.Fatalf("received event idx = %d, want %d", ev.Idx, i)
+			}
+		}
+	})
+}
+
+func TestOpenErrors(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if os.Geteuid() != 0 {
+			if err := f.Chmod(0); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Watch()
+			if !errors.Is(err, ErrPermission) {
+				t.Errorf("Watch() err = %v, want %v", err, ErrPermission)
+			}
+			if !errors.Is(err, os.ErrPermission) {
+				t.Errorf("Watch() err = %v, want %v", err, os.ErrPermission)
+			}
+		}
+		controlFile = filepath.Join(filepath.Dir(f.Name()), "missing")
+		_, err := Watch()
+		if !errors.Is(err, ErrNotExist) || !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Watch() err = %v, want %v", err, ErrNotExist)
+		}
+		if errors.Is(err, ErrPermission) {
+			t.Errorf("Watch() err = %v, must not be %v", err, ErrPermission)
+		}
+		var e *OpenError
+		if !errors.As(err, &e) || e.Path != controlFile || e.Err != syscall.ENOENT {
+			t.Errorf("Watch() err = %#v, want OpenError{Path: %q, Err: ENOENT}", err, controlFile)
+		}
+	})
+}
+
+func TestNewWatcherOpenTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// opening a fifo for reading blocks until it has a writer
+	name := filepath.Join(dir, "rfkill")
+	if err = syscall.Mkfifo(name, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = NewWatcher(ctx, WithFile(name))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("NewWatcher() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	var e *OpenError
+	if !errors.As(err, &e) || e.Path != name {
+		t.Fatalf("NewWatcher() err = %#v, want OpenError{Path: %q}", err, name)
+	}
+
+	// unblock the abandoned open
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestCheckCharDevice(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if err := checkCharDevice(f); err == nil {
+			t.Fatal("checkCharDevice of a regular file expected to fail")
+		}
+	})
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = checkCharDevice(f); err != nil {
+		t.Fatalf("checkCharDevice(%s) err = %v", os.DevNull, err)
+	}
+}
+
+func TestCloseOnExec(t *testing.T) {
+	withControlFile(t, func(_ *os.File) {
+		w, err := NewWatcher(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		checkCloseOnExec(t, w.file)
+
+		c, err := Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		checkCloseOnExec(t, c.file)
+	})
+}
+
+func checkCloseOnExec(t *testing.T, f *os.File) {
+	t.Helper()
+	rc, err := f.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags uintptr
+	var errno syscall.Errno
+	if err = rc.Control(func(fd uintptr) {
+		flags, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFD, 0)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	if flags&syscall.FD_CLOEXEC == 0 {
+		t.Fatalf("%s is not close-on-exec", f.Name())
+	}
+}
+
+func TestSupported(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			if !Supported() {
+				t.Fatal("Supported() = false, want true")
+			}
+			controlFile = filepath.Join(dir, "missing")
+			sysfsPath = controlFile
+			if Supported() {
+				t.Fatal("Supported() = true, want false")
+			}
+		})
+	})
+}
+
+func TestStateByIdxNotExist(t *testing.T) {
+	if _, _, err := StateByIdx(^uint32(0)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("StateByIdx of missing device err = %v, want not exist", err)
+	}
+}
+
+func TestSysfsTypes(t *testing.T) {
+	// sysfs names differ from Type.String, e.g. WLAN is "wlan" in sysfs but "wifi" in String
+	if name := sysfsTypes[TypeWLAN]; name != "wlan" {
+		t.Fatalf("sysfs name of %s = %q, want %q", Type(TypeWLAN), name, "wlan")
+	}
+	seen := map[string]bool{}
+	for typ, name := range sysfsTypes {
+		if seen[name] {
+			t.Fatalf("sysfs name %q of %s is not unique", name, typ)
+		}
+		seen[name] = true
+	}
+}
+
+func TestNameByIdxNotExist(t *testing.T) {
+	if _, err := NameByIdx(^uint32(0)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("NameByIdx of missing device err = %v, want not exist", err)
+	}
+}
+
+// readEvents reads n events from the beginning of f.
+func readEvents(t *testing.T, f *os.File, n int) []Event {
+	t.Helper()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	evs := make([]Event, n)
+	if err := binary.Read(f, endianness, evs); err != nil {
+		t.Fatal(err)
+	}
+	return evs
+}
+
+func TestKernelABI(t *testing.T) {
+	// values of enum rfkill_operation and enum rfkill_type
+	// in include/uapi/linux/rfkill.h, they must never change
+	for op, want := range map[Op]uint8{
+		OpAdd:       0,
+		OpDel:       1,
+		OpChange:    2,
+		OpChangeAll: 3,
+	} {
+		if uint8(op) != want {
+			t.Errorf("Op %s = %d, want %d", op, op, want)
+		}
+	}
+	for typ, want := range map[Type]uint8{
+		TypeAll:       0,
+		TypeWLAN:      1,
+		TypeBluetooth: 2,
+		TypeUWB:       3,
+		TypeWiMAX:     4,
+		TypeWWAN:      5,
+		TypeGPS:       6,
+		TypeFM:        7,
+		TypeNFC:       8,
+	} {
+		if uint8(typ) != want {
+			t.Errorf("Type %s = %d, want %d", typ, typ, want)
+		}
+	}
+}
+
+func TestParseOp(t *testing.T) {
+	for s, want := range map[string]Op{
+		"add":        OpAdd,
+		"Delete":     OpDel,
+		"change":     OpChange,
+		"CHANGE-ALL": OpChangeAll,
+	} {
+		op, err := ParseOp(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != want {
+			t.Errorf("ParseOp(%q) = %s, want %s", s, op, want)
+		}
+	}
+	for _, s := range []string{"", "del"} {
+		if _, err := ParseOp(s); err == nil {
+			t.Errorf("ParseOp(%q) expected to fail", s)
+		}
+	}
+}
+
+func TestOpText(t *testing.T) {
+	want := []Op{OpAdd, OpChangeAll}
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `["add","change-all"]` {
+		t.Fatalf("marshaled ops = %s", b)
+	}
+	var got []Op
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unmarshaled ops = %v, want %v", got, want)
+	}
+	if err = json.Unmarshal([]byte(`["foo"]`), &got); err == nil {
+		t.Fatal("unmarshaling unknown op expected to fail")
+	}
+	if _, err = json.Marshal(Op(OpChangeAll + 1)); err == nil {
+		t.Fatal("marshaling unknown op expected to fail")
+	}
+}
+
+func TestValid(t *testing.T) {
+	for op, want := range map[Op]bool{
+		OpAdd:           true,
+		OpChangeAll:     true,
+		OpChangeAll + 1: false,
+		255:             false,
+	} {
+		if got := op.Valid(); got != want {
+			t.Errorf("Op(%d).Valid() = %t, want %t", op, got, want)
+		}
+	}
+	for typ, want := range map[Type]bool{
+		TypeAll:     true,
+		TypeNFC:     true,
+		TypeNFC + 1: false,
+		255:         false,
+	} {
+		if got := typ.Valid(); got != want {
+			t.Errorf("Type(%d).Valid() = %t, want %t", typ, got, want)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for s, want := range map[string]Type{
+		"all":           TypeAll,
+		"wifi":          TypeWLAN,
+		"WLAN":          TypeWLAN,
+		"Bluetooth":     TypeBluetooth,
+		"ultrawideband": TypeUWB,
+		"nfc":           TypeNFC,
+	} {
+		typ, err := ParseType(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != want {
+			t.Errorf("ParseType(%q) = %s, want %s", s, typ, want)
+		}
+	}
+	for _, s := range []string{"", "wi-fi"} {
+		if _, err := ParseType(s); err == nil {
+			t.Errorf("ParseType(%q) expected to fail", s)
+		}
+	}
+}
+
+func TestTypeRoundTrip(t *testing.T) {
+	for typ := Type(TypeAll); typ <= TypeNFC; typ++ {
+		got, err := ParseType(typ.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != typ {
+			t.Errorf("ParseType(%q) = %s, want %s", typ.String(), got, typ)
+		}
+	}
+}
+
+func TestTypeText(t *testing.T) {
+	want := []Type{TypeBluetooth, TypeWWAN}
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `["bluetooth","wwan"]` {
+		t.Fatalf("marshaled types = %s", b)
+	}
+	var got []Type
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unmarshaled types = %v, want %v", got, want)
+	}
+	if err = json.Unmarshal([]byte(`["foo"]`), &got); err == nil {
+		t.Fatal("unmarshaling unknown type expected to fail")
+	}
+	if _, err = json.Marshal(Type(TypeNFC + 1)); err == nil {
+		t.Fatal("marshaling unknown type expected to fail")
+	}
+}
+
+func TestEndianness(t *testing.T) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, endianness, Event{Idx: 0x01020304}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if idx := *(*uint32)(unsafe.Pointer(&b[0])); idx != 0x01020304 {
+		t.Fatalf("idx in native layout = %#x, want %#x", idx, 0x01020304)
+	}
+}
+
+func TestEventLayout(t *testing.T) {
+	if n := binary.Size(Event{}); n != eventSize {
+		t.Fatalf("encoded event size = %d, want %d", n, eventSize)
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, endianness, Event{
+		Type: 1, Op: 2, Soft: 3, Hard: 4,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b := buf.Bytes()[4:]; !bytes.Equal(b, []byte{1, 2, 3, 4}) {
+		t.Fatalf("encoded type, op, soft and hard = %v, want [1 2 3 4]", b)
+	}
+}
+
+func TestEachTruncatedEvent(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		if _, err := f.Write([]byte{1, 0, 0, 0, 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Each(func(ev Event) error {
+			t.Fatalf("unexpected event %#v", ev)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestWatchTruncatedEvent(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := Watch()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		if _, err = f.Write([]byte{1, 0, 0, 0, 1}); err != nil {
+			t.Fatal(err)
+		}
+		waitRead(t, f)
+		want := Event{Idx: 2, Op: OpAdd}
+		if err = binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %#v, want %#v", ev, want)
+		}
+	})
+}
+
+func TestNewWatcherWithErrors(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		w, err := NewWatcher(context.Background(), WithErrors())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+
+		if _, err = f.Write([]byte{1, 0, 0, 0, 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err = <-w.Errors(); err != ErrTruncatedEvent {
+			t.Fatalf("Errors() delivered %v, want %v", err, ErrTruncatedEvent)
+		}
+		want := Event{Idx: 2, Op: OpAdd}
+		if err = binary.Write(f, endianness, want); err != nil {
+			t.Fatal(err)
+		}
+		if ev := <-w.C(); ev != want {
+			t.Fatalf("received event = %#v, want %#v", ev, want)
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := <-w.Errors(); ok {
+			t.Fatal("Errors() is not closed after Close")
+		}
+	})
+}
+
+func TestEventString(t *testing.T) {
+	ev := Event{Idx: 1, Type: TypeBluetooth, Op: OpChange, Soft: 1}
+	want := "idx=1 type=bluetooth op=change soft=true hard=false"
+	if s := ev.String(); s != want {
+		t.Fatalf("String() = %q, want %q", s, want)
+	}
+}
+
+func TestDeviceString(t *testing.T) {
+	dev := Device{Idx: 2, Name: "phy2", Type: TypeWLAN, Hard: true}
+	want := "rfkill2 phy2 wifi soft=false hard=true"
+	if s := dev.String(); s != want {
+		t.Fatalf("String() = %q, want %q", s, want)
+	}
+}
+
+func TestEventMatches(t *testing.T) {
+	ev := Event{Idx: 1, Type: TypeWLAN, Op: OpChange, Soft: 1}
+	if !ev.Equal(Event{Idx: 1, Type: TypeWLAN, Op: OpChange, Soft: 1}) {
+		t.Error("Equal of identical events = false, want true")
+	}
+	if ev.Equal(Event{Idx: 1, Type: TypeWLAN, Op: OpChange}) {
+		t.Error("Equal of different events = true, want false")
+	}
+	for _, c := range []struct {
+		ops   []Op
+		types []Type
+		want  bool
+	}{
+		{nil, nil, true},
+		{[]Op{}, []Type{}, true},
+		{[]Op{OpAdd, OpChange}, nil, true},
+		{nil, []Type{TypeBluetooth, TypeWLAN}, true},
+		{[]Op{OpChange}, []Type{TypeWLAN}, true},
+		{[]Op{OpAdd}, nil, false},
+		{nil, []Type{TypeBluetooth}, false},
+		{[]Op{OpChange}, []Type{TypeBluetooth}, false},
+	} {
+		if got := ev.Matches(c.ops, c.types); got != c.want {
+			t.Errorf("Matches(%v, %v) = %t, want %t", c.ops, c.types, got, c.want)
+		}
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	want := Event{Idx: 1, Type: TypeWLAN, Op: OpAdd, Hard: 1}
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := `{"idx":1,"type":"wifi","op":"add","soft":false,"hard":true}`; string(b) != s {
+		t.Fatalf("marshaled event = %s, want %s", b, s)
+	}
+	var got Event
+	if err = json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("unmarshaled event = %#v, want %#v", got, want)
+	}
+}
+
+func TestNameByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "name", "phy0\n")
+		name, err := NameByIdx(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "phy0" {
+			t.Fatalf("NameByIdx = %q, want %q", name, "phy0")
+		}
+	})
+}
+
+func TestStateByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 1, "soft", "1\n")
+		writeAttr(t, dir, 1, "hard", "0\n")
+		soft, hard, err := StateByIdx(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !soft || hard {
+			t.Fatalf("StateByIdx = %t, %t, want true, false", soft, hard)
+		}
+		if _, _, err = StateByIdx(2); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("StateByIdx of missing device err = %v, want not exist", err)
+		}
+	})
+}
+
+func TestReadAttrEINTR(t *testing.T) {
+	tmp := readFile
+	defer func() {
+		readFile = tmp
+	}()
+
+	var n int
+	readFile = func(name string) ([]byte, error) {
+		if n++; n <= 2 {
+			return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EINTR}
+		}
+		return []byte(" phy0\n"), nil
+	}
+	v, err := readAttr(0, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "phy0" {
+		t.Fatalf("readAttr = %q, want %q", v, "phy0")
+	}
+	if n != 3 {
+		t.Fatalf("readAttr made %d attempts, want 3", n)
+	}
+
+	readFile = func(name string) ([]byte, error) {
+		return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EIO}
+	}
+	if _, err = readAttr(0, "name"); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("readAttr err = %v, want %v", err, syscall.EIO)
+	}
+}
+
+func TestHardBlockedByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "hard", "1\n")
+		hard, err := HardBlockedByIdx(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hard {
+			t.Fatal("HardBlockedByIdx = false, want true")
+		}
+	})
+}
+
+func TestPersistentByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "persistent", "1\n")
+		persistent, err := PersistentByIdx(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !persistent {
+			t.Fatal("PersistentByIdx = false, want true")
+		}
+	})
+}
+
+func TestTypeByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "type", "wlan\n")
+		writeAttr(t, dir, 1, "type", "unknown\n")
+		typ, err := TypeByIdx(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != TypeWLAN {
+			t.Fatalf("TypeByIdx = %s, want %s", typ, Type(TypeWLAN))
+		}
+		if _, err = TypeByIdx(1); err == nil {
+			t.Fatal("TypeByIdx of unknown type expected to fail")
+		}
+	})
+}
+
+func TestInterfacesByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "device/device/net/wlan0/ifindex", "3\n")
+		writeAttr(t, dir, 1, "device/name", "hci0\n")
+		for idx, want := range map[uint32][]string{
+			0: {"wlan0"},
+			1: {},
+		} {
+			names, err := InterfacesByIdx(idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("InterfacesByIdx(%d) = %q, want %q", idx, names, want)
+			}
+		}
+		if _, err := InterfacesByIdx(2); err != ErrNotExist {
+			t.Fatalf("InterfacesByIdx of missing device err = %v, want %v", err, ErrNotExist)
+		}
+	})
+}
+
+func TestDevicePathByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeAttr(t, dir, 0, "name", "phy0\n")
+		phy := filepath.Join(dir, "devices", "pci0000:00", "phy0")
+		if err := os.MkdirAll(phy, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join("..", "devices", "pci0000:00", "phy0"),
+			filepath.Join(dir, "rfkill0", "device")); err != nil {
+			t.Fatal(err)
+		}
+		want, err := filepath.EvalSymlinks(phy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := DevicePathByIdx(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != want {
+			t.Fatalf("DevicePathByIdx(0) = %q, want %q", path, want)
+		}
+		if _, err = DevicePathByIdx(1); err != ErrNotExist {
+			t.Fatalf("DevicePathByIdx of missing device err = %v, want %v", err, ErrNotExist)
+		}
+	})
+}
+
+func TestListDevices(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		for _, dev := range []Device{
+			{Idx: 10, Name: "hci0", Type: TypeBluetooth, Soft: true},
+			{Idx: 2, Name: "phy0", Type: TypeWLAN, Hard: true},
+		} {
+			writeDevice(t, dir, dev)
+		}
+		devs, err := ListDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Device{
+			{Idx: 2, Name: "phy0", Type: TypeWLAN, Hard: true},
+			{Idx: 10, Name: "hci0", Type: TypeBluetooth, Soft: true},
+		}
+		if !reflect.DeepEqual(devs, want) {
+			t.Fatalf("ListDevices = %#v, want %#v", devs, want)
+		}
+	})
+}
+
+func TestIdxByName(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+		writeDevice(t, dir, Device{Idx: 1, Name: "hci0", Type: TypeBluetooth})
+		writeDevice(t, dir, Device{Idx: 2, Name: "hci0", Type: TypeBluetooth})
+
+		idx, err := IdxByName(" phy0\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx != 0 {
+			t.Fatalf("IdxByName = %d, want 0", idx)
+		}
+		if _, err = IdxByName("hci0"); err == nil {
+			t.Fatal("IdxByName of ambiguous name expected to fail")
+		}
+		if _, err = IdxByName("phy1"); err != ErrNotExist {
+			t.Fatalf("IdxByName of missing device err = %v, want %v", err, ErrNotExist)
+		}
+	})
+}
+
+func TestResolve(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		for _, dev := range []Device{
+			{Idx: 0, Name: "phy0", Type: TypeWLAN},
+			{Idx: 1, Name: "hci0", Type: TypeBluetooth},
+			{Idx: 2, Name: "phy0", Type: TypeWLAN},
+		} {
+			writeDevice(t, dir, dev)
+		}
+		for spec, want := range map[string][]uint32{
+			"7":    {7},
+			"wlan": {0, 2},
+			"all":  {0, 1, 2},
+			"gps":  {},
+			"hci0": {1},
+			"phy0": {0, 2},
+		} {
+			idxs, err := Resolve(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(idxs, want) {
+				t.Errorf("Resolve(%q) = %v, want %v", spec, idxs, want)
+			}
+		}
+		if _, err := Resolve("phy9"); err != ErrNotExist {
+			t.Fatalf("Resolve of missing device err = %v, want %v", err, ErrNotExist)
+		}
+	})
+}
+
+func TestPresentTypes(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		types, err := PresentTypes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if types == nil || len(types) != 0 {
+			t.Fatalf("PresentTypes() without devices = %#v, want empty", types)
+		}
+
+		writeDevice(t, dir, Device{Idx: 0, Name: "hci0", Type: TypeBluetooth})
+		writeDevice(t, dir, Device{Idx: 1, Name: "phy1", Type: TypeWLAN})
+		writeDevice(t, dir, Device{Idx: 2, Name: "phy2", Type: TypeWLAN})
+		if types, err = PresentTypes(); err != nil {
+			t.Fatal(err)
+		}
+		if want := []Type{TypeWLAN, TypeBluetooth}; !reflect.DeepEqual(types, want) {
+			t.Fatalf("PresentTypes() = %v, want %v", types, want)
+		}
+	})
+}
+
+func TestBlockedDevices(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		devs := []Device{
+			{Idx: 0, Name: "phy0", Type: TypeWLAN},
+			{Idx: 1, Name: "hci0", Type: TypeBluetooth, Soft: true},
+			{Idx: 2, Name: "phy2", Type: TypeWLAN, Hard: true},
+			{Idx: 3, Name: "wwan0", Type: TypeWWAN},
+		}
+		for _, dev := range devs {
+			writeDevice(t, dir, dev)
+		}
+		blocked, err := BlockedDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := devs[1:3]; !reflect.DeepEqual(blocked, want) {
+			t.Fatalf("BlockedDevices() = %v, want %v", blocked, want)
+		}
+		unblocked, err := UnblockedDevices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []Device{devs[0], devs[3]}; !reflect.DeepEqual(unblocked, want) {
+			t.Fatalf("UnblockedDevices() = %v, want %v", unblocked, want)
+		}
+	})
+}
+
+func TestEachDevice(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeDevice(t, dir, Device{Idx: 1, Name: "hci0", Type: TypeBluetooth})
+		writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+		var names []string
+		if err := EachDevice(func(dev Device) error {
+			names = append(names, dev.Name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"phy0", "hci0"}; !reflect.DeepEqual(names, want) {
+			t.Fatalf("EachDevice yielded %v, want %v", names, want)
+		}
+	})
+}
+
+func BenchmarkListDevices(b *testing.B) {
+	withSysfs(b, func(dir string) {
+		for i := uint32(0); i < 32; i++ {
+			writeDevice(b, dir, Device{Idx: i, Name: fmt.Sprintf("phy%d", i), Type: TypeWLAN})
+		}
+		for _, n := range []int{1, listWorkers} {
+			b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+				tmp := listWorkers
+				listWorkers = n
+				defer func() {
+					listWorkers = tmp
+				}()
+				for i := 0; i < b.N; i++ {
+					devs, err := ListDevices()
+					if err != nil {
+						b.Fatal(err)
+					}
+					if len(devs) != 32 {
+						b.Fatalf("len(ListDevices()) = %d, want 32", len(devs))
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestCountByType(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+		writeDevice(t, dir, Device{Idx: 1, Name: "phy1", Type: TypeWLAN})
+		writeDevice(t, dir, Device{Idx: 2, Name: "hci0", Type: TypeBluetooth})
+		m, err := CountByType()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[Type]int{TypeWLAN: 2, TypeBluetooth: 1}
+		if !reflect.DeepEqual(m, want) {
+			t.Fatalf("CountByType = %v, want %v", m, want)
+		}
+	})
+}
+
+func TestGetByIdx(t *testing.T) {
+	withSysfs(t, func(dir string) {
+		want := Device{Idx: 3, Name: "phy3", Type: TypeWLAN, Soft: true, Persistent: true}
+		writeDevice(t, dir, want)
+		dev, err := GetByIdx(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dev != want {
+			t.Fatalf("GetByIdx = %#v, want %#v", dev, want)
+		}
+		if _, err = GetByIdx(4); err != ErrNotExist {
+			t.Fatalf("GetByIdx of missing device err = %v, want %v", err, ErrNotExist)
+		}
+	})
+}
+
+func TestBlockByName(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+			writeDevice(t, dir, Device{Idx: 1, Name: "hci0", Type: TypeBluetooth})
+			if err := BlockByName("hci0", true); err != nil {
+				t.Fatal(err)
+			}
+			want := Event{Idx: 1, Op: OpChange, Soft: 1}
+			if got := readEvents(t, f, 1); got[0] != want {
+				t.Fatalf("BlockByName written event = %#v, want %#v", got[0], want)
+			}
+			if err := BlockByName("phy1", true); err != ErrNotExist {
+				t.Fatalf("BlockByName of missing device err = %v, want %v", err, ErrNotExist)
+			}
+		})
+	})
+}
+
+func TestWrite(t *testing.T) {
+	for _, op := range []Op{OpAdd, OpDel, OpChange, OpChangeAll} {
+		t.Run(op.String(), func(t *testing.T) {
+			withControlFile(t, func(f *os.File) {
+				want := Event{Idx: 5, Type: TypeGPS, Op: op, Soft: 1}
+				if err := Write(want); err != nil {
+					t.Fatal(err)
+				}
+				if got := readEvents(t, f, 1); got[0] != want {
+					t.Fatalf("Write written event = %#v, want %#v", got[0], want)
+				}
+			})
+		})
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	withControlFile(t, func(f *os.File) {
+		for _, ev := range []Event{
+			{Op: OpChangeAll + 1},
+			{Type: TypeNFC + 1},
+			{Op: OpChange, Hard: 1},
+		} {
+			if err := Write(ev); err == nil {
+				t.Errorf("Write(%#v) expected to fail", ev)
+			}
+		}
+		if fi, err := f.Stat(); err != nil {
+			t.Fatal(err)
+		} else if fi.Size() != 0 {
+			t.Fatalf("invalid events written to the control file")
+		}
+	})
+}
+
+func withSysfs(t testing.TB, fn func(dir string)) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := sysfsPath
+	sysfsPath = dir
+	defer func() {
+		sysfsPath = tmp
+		os.RemoveAll(dir)
+	}()
+	fn(dir)
+}
+
+// writeAttr creates the named attribute file of device idx in a fake sysfs dir.
+func writeAttr(t testing.TB, dir string, idx uint32, attr, value string) {
+	t.Helper()
+	name := filepath.Join(dir, fmt.Sprintf("rfkill%d", idx), attr)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, []byte(value), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeDevice creates all attributes of dev in a fake sysfs dir.
+func writeDevice(t testing.TB, dir string, dev Device) {
+	t.Helper()
+	writeAttr(t, dir, dev.Idx, "name", dev.Name+"\n")
+	writeAttr(t, dir, dev.Idx, "type", sysfsTypes[dev.Type]+"\n")
+	for attr, v := range map[string]bool{
+		"soft":       dev.Soft,
+		"hard":       dev.Hard,
+		"persistent": dev.Persistent,
+	} {
+		if v {
+			writeAttr(t, dir, dev.Idx, attr, "1\n")
+		} else {
+			writeAttr(t, dir, dev.Idx, attr, "0\n")
+		}
+	}
+}
+
+// withControlFifo substitutes the control file with a named pipe,
+// unlike regular files reading from it blocks until fn writes something.
+func withControlFifo(t testing.TB, fn func(f *os.File)) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "rfkill")
+	if err = syscall.Mkfifo(name, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// O_RDWR doesn't block until the other end is opened
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tmp := controlFile
+	controlFile = name
+	defer func() {
+		controlFile = tmp
+	}()
+	fn(f)
+}
+
+// waitRead waits until everything written to the fifo f is consumed by the reader.
+func waitRead(t *testing.T, f *os.File) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		var n int32
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(),
+			syscall.TIOCINQ, uintptr(unsafe.Pointer(&n))); errno != 0 {
+			t.Fatal(errno)
+		}
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("fifo is not drained")
+}
+
 func withControlFile(t *testing.T, fn func(f *os.File)) {
 	f, err := ioutil.TempFile("", "")
 	if err != nil {
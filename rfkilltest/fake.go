@@ -0,0 +1,195 @@
+//+build linux
+
+// Package rfkilltest provides an in-memory rfkill.Controller
+// for testing code that depends on rfkill.
+package rfkilltest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/amenzhinsky/rfkill"
+)
+
+// Fake is a rfkill.Controller that keeps devices in memory.
+//
+// Watchers it creates read events from fifos, so they behave like real
+// ones: OpAdd events are reported for all devices first and then
+// every change made by the fake is delivered as it happens.
+type Fake struct {
+	mu      sync.Mutex
+	dir     string
+	devices map[uint32]rfkill.Device
+	fifos   []*os.File
+	n       int // number of created fifos used for naming them
+}
+
+var _ rfkill.Controller = (*Fake)(nil)
+
+// New creates a fake with the given devices, it has to be closed after use.
+func New(devices ...rfkill.Device) (*Fake, error) {
+	dir, err := ioutil.TempDir("", "rfkilltest")
+	if err != nil {
+		return nil, err
+	}
+	f := &Fake{dir: dir, devices: make(map[uint32]rfkill.Device, len(devices))}
+	for _, dev := range devices {
+		f.devices[dev.Idx] = dev
+	}
+	return f, nil
+}
+
+// Block changes the soft block state of the named device
+// and reports it to watchers as an OpChange event.
+func (f *Fake) Block(idx uint32, block bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dev, ok := f.devices[idx]
+	if !ok {
+		return rfkill.ErrNotExist
+	}
+	dev.Soft = block
+	f.devices[idx] = dev
+	return f.broadcast(event(dev, rfkill.OpChange))
+}
+
+// Add registers the device, replacing a one with the same idx,
+// and reports it to watchers as an OpAdd event.
+func (f *Fake) Add(dev rfkill.Device) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices[dev.Idx] = dev
+	return f.broadcast(event(dev, rfkill.OpAdd))
+}
+
+// Remove unregisters the named device and reports it
+// to watchers as an OpDel event.
+func (f *Fake) Remove(idx uint32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dev, ok := f.devices[idx]
+	if !ok {
+		return rfkill.ErrNotExist
+	}
+	delete(f.devices, idx)
+	return f.broadcast(event(dev, rfkill.OpDel))
+}
+
+// List returns all devices sorted by idx.
+func (f *Fake) List() ([]rfkill.Device, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.list(), nil
+}
+
+func (f *Fake) list() []rfkill.Device {
+	devs := make([]rfkill.Device, 0, len(f.devices))
+	for _, dev := range f.devices {
+		devs = append(devs, dev)
+	}
+	sort.Slice(devs, func(i, j int) bool {
+		return devs[i].Idx < devs[j].Idx
+	})
+	return devs
+}
+
+// Watch starts watching for events with the given ops.
+//
+// The fifo of the watcher is removed once the watcher is closed.
+func (f *Fake) Watch(ops ...rfkill.Op) (*rfkill.Watcher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := filepath.Join(f.dir, strconv.Itoa(f.n))
+	if err := syscall.Mkfifo(name, 0600); err != nil {
+		return nil, err
+	}
+	f.n++
+	// O_RDWR doesn't block until the other end is opened
+	rw, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	defer rw.Close()
+	for _, dev := range f.list() {
+		if err = write(rw, event(dev, rfkill.OpAdd)); err != nil {
+			os.Remove(name)
+			return nil, err
+		}
+	}
+	w, err := rfkill.NewWatcher(context.Background(),
+		rfkill.WithFile(name), rfkill.WithOps(ops...),
+	)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	// the write-only end gets EPIPE when the watcher closes the other
+	// one, that's how broadcast finds out that it's not needed anymore
+	fifo, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		w.Close()
+		os.Remove(name)
+		return nil, err
+	}
+	f.fifos = append(f.fifos, fifo)
+	return w, nil
+}
+
+// Close releases all resources, streams of watchers created by the fake
+// get closed with rfkill.ErrDeviceClosed but they still have to be closed.
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, fifo := range f.fifos {
+		fifo.Close()
+	}
+	f.fifos = nil
+	return os.RemoveAll(f.dir)
+}
+
+// broadcast writes the event to fifos of all watchers,
+// fifos of closed watchers are closed and removed.
+func (f *Fake) broadcast(ev rfkill.Event) error {
+	fifos := f.fifos[:0]
+	for i, fifo := range f.fifos {
+		if err := write(fifo, ev); err != nil {
+			if !errors.Is(err, syscall.EPIPE) {
+				f.fifos = append(fifos, f.fifos[i:]...)
+				return err
+			}
+			fifo.Close()
+			os.Remove(fifo.Name())
+			continue
+		}
+		fifos = append(fifos, fifo)
+	}
+	f.fifos = fifos
+	return nil
+}
+
+func event(dev rfkill.Device, op rfkill.Op) rfkill.Event {
+	ev := rfkill.Event{Idx: dev.Idx, Type: dev.Type, Op: op}
+	if dev.Soft {
+		ev.Soft = 1
+	}
+	if dev.Hard {
+		ev.Hard = 1
+	}
+	return ev
+}
+
+// write writes the event in the kernel's native layout,
+// which rfkill.Event follows.
+func write(fifo *os.File, ev rfkill.Event) error {
+	_, err := fifo.Write((*[unsafe.Sizeof(ev)]byte)(unsafe.Pointer(&ev))[:])
+	return err
+}
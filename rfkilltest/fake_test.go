@@ -0,0 +1,115 @@
+//+build linux
+
+package rfkilltest
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/amenzhinsky/rfkill"
+)
+
+func TestFake(t *testing.T) {
+	f, err := New(
+		rfkill.Device{Idx: 1, Name: "phy1", Type: rfkill.TypeBluetooth},
+		rfkill.Device{Idx: 0, Name: "phy0", Type: rfkill.TypeWLAN},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var c rfkill.Controller = f
+	w, err := c.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err = c.Block(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Block(2, true); err != rfkill.ErrNotExist {
+		t.Fatalf("Block of missing device err = %v, want %v", err, rfkill.ErrNotExist)
+	}
+	if err = f.Remove(0); err != nil {
+		t.Fatal(err)
+	}
+
+	evs, err := w.Drain(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rfkill.Event{
+		{Idx: 0, Type: rfkill.TypeWLAN, Op: rfkill.OpAdd},
+		{Idx: 1, Type: rfkill.TypeBluetooth, Op: rfkill.OpAdd},
+		{Idx: 1, Type: rfkill.TypeBluetooth, Op: rfkill.OpChange, Soft: 1},
+		{Idx: 0, Type: rfkill.TypeWLAN, Op: rfkill.OpDel},
+	}
+	if !reflect.DeepEqual(evs, want) {
+		t.Fatalf("received events = %v, want %v", evs, want)
+	}
+
+	devs, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []rfkill.Device{
+		{Idx: 1, Name: "phy1", Type: rfkill.TypeBluetooth, Soft: true},
+	}; !reflect.DeepEqual(devs, want) {
+		t.Fatalf("List() = %v, want %v", devs, want)
+	}
+}
+
+func TestFakeClosedWatcher(t *testing.T) {
+	f, err := New(rfkill.Device{Idx: 0, Name: "phy0", Type: rfkill.TypeWLAN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := f.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// way more than fits in a pipe buffer, so it hangs
+	// when the closed watcher's fifo is still written to
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 20000; i++ {
+			if err := f.Block(0, i%2 == 0); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Block hangs writing to the closed watcher's fifo")
+	}
+
+	f.mu.Lock()
+	n := len(f.fifos)
+	f.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("fifos of closed watchers = %d, want 0", n)
+	}
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("fifo files of closed watchers = %d, want 0", len(files))
+	}
+}
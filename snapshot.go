@@ -0,0 +1,86 @@
+package rfkill
+
+import "sort"
+
+// Snapshot returns the current state of all registered devices keyed by idx.
+func Snapshot() (map[uint32]Device, error) {
+	devs, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[uint32]Device, len(devs))
+	for _, dev := range devs {
+		m[dev.Idx] = dev
+	}
+	return m, nil
+}
+
+// ChangeKind is kind of a device state transition.
+type ChangeKind uint8
+
+const (
+	// ChangeAdded a device is registered.
+	ChangeAdded ChangeKind = iota
+
+	// ChangeRemoved a device is unregistered.
+	ChangeRemoved
+
+	// ChangeModified a device's state is changed.
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return ""
+	}
+}
+
+// Change is a device state transition between two snapshots.
+type Change struct {
+	// Kind of the change.
+	Kind ChangeKind
+
+	// Old device state, empty for added devices.
+	Old Device
+
+	// New device state, empty for removed devices.
+	New Device
+}
+
+// Diff returns changes needed to get from the old snapshot to the new one
+// sorted by idx, unchanged devices are omitted.
+func Diff(old, new map[uint32]Device) []Change {
+	var changes []Change
+	for idx, o := range old {
+		n, ok := new[idx]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeRemoved, Old: o})
+		case n != o:
+			changes = append(changes, Change{Kind: ChangeModified, Old: o, New: n})
+		}
+	}
+	for idx, n := range new {
+		if _, ok := old[idx]; !ok {
+			changes = append(changes, Change{Kind: ChangeAdded, New: n})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].idx() < changes[j].idx()
+	})
+	return changes
+}
+
+func (c Change) idx() uint32 {
+	if c.Kind == ChangeAdded {
+		return c.New.Idx
+	}
+	return c.Old.Idx
+}
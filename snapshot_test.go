@@ -0,0 +1,29 @@
+package rfkill
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	wlan := Device{Idx: 0, Name: "phy0", Type: TypeWLAN}
+	wlanBlocked := Device{Idx: 0, Name: "phy0", Type: TypeWLAN, Soft: true}
+	bt := Device{Idx: 1, Name: "hci0", Type: TypeBluetooth}
+	nfc := Device{Idx: 2, Name: "nfc0", Type: TypeNFC}
+
+	got := Diff(
+		map[uint32]Device{0: wlan, 1: bt},
+		map[uint32]Device{0: wlanBlocked, 2: nfc},
+	)
+	want := []Change{
+		{Kind: ChangeModified, Old: wlan, New: wlanBlocked},
+		{Kind: ChangeRemoved, Old: bt},
+		{Kind: ChangeAdded, New: nfc},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff = %v, want %v", got, want)
+	}
+	if got = Diff(map[uint32]Device{1: bt}, map[uint32]Device{1: bt}); len(got) != 0 {
+		t.Fatalf("Diff of equal snapshots = %v, want none", got)
+	}
+}
@@ -0,0 +1,718 @@
+// This is a rfkill client library for golang, works only on linux,
+// on other platforms all functions return ErrUnsupported.
+//
+// For implementation details see:
+// https://github.com/torvalds/linux/blob/master/include/uapi/linux/rfkill.h
+package rfkill
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Op is operation type.
+type Op uint8
+
+const (
+	// OpAdd a device is added.
+	OpAdd = iota
+
+	// OpDel a device is deleted.
+	OpDel
+
+	// OpChange a device's state is changed.
+	OpChange
+
+	// OpChangeAll userspace changes in all devices.
+	OpChangeAll
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpAdd:
+		return "add"
+	case OpDel:
+		return "delete"
+	case OpChange:
+		return "change"
+	case OpChangeAll:
+		return "change-all"
+	default:
+		return ""
+	}
+}
+
+// Valid reports whether op is one of the defined constants.
+func (op Op) Valid() bool {
+	return op <= OpChangeAll
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (op Op) MarshalText() ([]byte, error) {
+	s := op.String()
+	if s == "" {
+		return nil, fmt.Errorf("rfkill: unknown op %d", op)
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (op *Op) UnmarshalText(b []byte) error {
+	v, err := ParseOp(string(b))
+	if err != nil {
+		return err
+	}
+	*op = v
+	return nil
+}
+
+// ParseOp parses an operation name returned by Op.String case-insensitively.
+func ParseOp(s string) (Op, error) {
+	for op := Op(OpAdd); op <= OpChangeAll; op++ {
+		if strings.EqualFold(s, op.String()) {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("rfkill: unknown op %q", s)
+}
+
+// Type is type of rfkill switch.
+type Type uint8
+
+const (
+	// TypeAll refers to switches of all types, it's used along
+	// with OpChangeAll to change all devices at once, see BlockAll.
+	TypeAll = iota
+
+	// TypeWLAN switch is on a 802.11 wireless network device.
+	TypeWLAN
+
+	// TypeBluetooth switch is on a bluetooth device.
+	TypeBluetooth
+
+	// TypeUWB switch is on a ultra wideband device.
+	TypeUWB
+
+	// TypeWiMAX switch is on a WiMAX device.
+	TypeWiMAX
+
+	// TypeWWAN switch is on a wireless WAN device.
+	TypeWWAN
+
+	// TypeGPS switch is on a GPS device.
+	TypeGPS
+
+	// TypeFM switch is on a FM radio device.
+	TypeFM
+
+	// TypeNFC switch is on an NFC device.
+	TypeNFC
+)
+
+func (typ Type) String() string {
+	switch typ {
+	case TypeAll:
+		return "all"
+	case TypeWLAN:
+		return "wifi"
+	case TypeBluetooth:
+		return "bluetooth"
+	case TypeUWB:
+		return "uwb"
+	case TypeWiMAX:
+		return "wimax"
+	case TypeWWAN:
+		return "wwan"
+	case TypeGPS:
+		return "gps"
+	case TypeFM:
+		return "fm"
+	case TypeNFC:
+		return "nfc"
+	default:
+		return ""
+	}
+}
+
+// Valid reports whether typ is one of the defined constants.
+func (typ Type) Valid() bool {
+	return typ <= TypeNFC
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (typ Type) MarshalText() ([]byte, error) {
+	s := typ.String()
+	if s == "" {
+		return nil, fmt.Errorf("rfkill: unknown type %d", typ)
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (typ *Type) UnmarshalText(b []byte) error {
+	v, err := ParseType(string(b))
+	if err != nil {
+		return err
+	}
+	*typ = v
+	return nil
+}
+
+// ParseType parses a type name case-insensitively, it accepts
+// names returned by Type.String, including "all" for TypeAll,
+// and sysfs ones like "wlan".
+func ParseType(s string) (Type, error) {
+	for typ := Type(TypeAll); typ <= TypeNFC; typ++ {
+		if strings.EqualFold(s, typ.String()) {
+			return typ, nil
+		}
+		if name, ok := sysfsTypes[typ]; ok && strings.EqualFold(s, name) {
+			return typ, nil
+		}
+	}
+	return 0, fmt.Errorf("rfkill: unknown type %q", s)
+}
+
+// sysfsTypes are type names used by the kernel in sysfs,
+// they differ from the Type.String ones.
+var sysfsTypes = map[Type]string{
+	TypeWLAN:      "wlan",
+	TypeBluetooth: "bluetooth",
+	TypeUWB:       "ultrawideband",
+	TypeWiMAX:     "wimax",
+	TypeWWAN:      "wwan",
+	TypeGPS:       "gps",
+	TypeFM:        "fm",
+	TypeNFC:       "nfc",
+}
+
+// Device is a rfkill device state read from sysfs.
+//
+// Unlike Event it describes the current state of a device
+// rather than a change of it, so it carries no operation code.
+type Device struct {
+	// Idx is device index.
+	Idx uint32
+
+	// Name is system name of the device.
+	Name string
+
+	// Type of the device.
+	Type Type
+
+	// Soft block state.
+	Soft bool
+
+	// Hard block state.
+	Hard bool
+
+	// Persistent reports whether the soft block state
+	// is preserved by the driver across reboots.
+	Persistent bool
+}
+
+// String returns the device in the stable form like
+// "rfkill2 phy2 wifi soft=false hard=false".
+func (dev Device) String() string {
+	return fmt.Sprintf("rfkill%d %s %s soft=%t hard=%t",
+		dev.Idx, dev.Name, dev.Type, dev.Soft, dev.Hard)
+}
+
+// ErrNotExist is returned when a device is not registered
+// or the control device is missing, e.g. the kernel is built without rfkill.
+var ErrNotExist = errors.New("rfkill: device does not exist")
+
+// ErrPermission is returned when the control device cannot
+// be opened due to insufficient privileges.
+var ErrPermission = errors.New("rfkill: permission denied")
+
+// OpenError is returned when the control device cannot be opened.
+//
+// errors.Is reports ErrNotExist and ErrPermission for it along with
+// the corresponding os errors, depending on the underlying error.
+type OpenError struct {
+	// Path is the control device path.
+	Path string
+
+	// Err is the underlying error, usually a syscall.Errno.
+	Err error
+}
+
+func (e *OpenError) Error() string {
+	return "rfkill: open " + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+// Is maps the underlying error to ErrNotExist and ErrPermission.
+func (e *OpenError) Is(target error) bool {
+	switch target {
+	case ErrNotExist:
+		return errors.Is(e.Err, os.ErrNotExist)
+	case ErrPermission:
+		return errors.Is(e.Err, os.ErrPermission)
+	default:
+		return false
+	}
+}
+
+// HardBlockedError is returned by WaitAllBlocked when devices are soft
+// unblocked but remain blocked by hardware switches software cannot clear.
+type HardBlockedError struct {
+	// Idxs are indices of the hard blocked devices sorted.
+	Idxs []uint32
+}
+
+func (e *HardBlockedError) Error() string {
+	s := make([]string, len(e.Idxs))
+	for i, idx := range e.Idxs {
+		s[i] = fmt.Sprint(idx)
+	}
+	return "rfkill: devices are still hard blocked: " + strings.Join(s, ", ")
+}
+
+// Event is a rfkill event read from /dev/rfkill.
+//
+// Its layout follows the kernel's struct rfkill_event,
+// use Device to describe the current state of a device.
+type Event struct {
+	// Idx is device index.
+	Idx uint32
+
+	// Type of the event.
+	Type Type
+
+	// Op operation code.
+	Op Op
+
+	// Soft state.
+	Soft uint8
+
+	// Hard state, it's read-only because it reflects
+	// a hardware switch that cannot be changed from software.
+	Hard uint8
+}
+
+func (ev Event) String() string {
+	return fmt.Sprintf("idx=%d type=%s op=%s soft=%t hard=%t",
+		ev.Idx, ev.Type, ev.Op, ev.Soft != 0, ev.Hard != 0)
+}
+
+// Equal reports whether both events have the same fields.
+func (ev Event) Equal(other Event) bool {
+	return ev == other
+}
+
+// Matches reports whether the event's op is one of ops and its type
+// is one of types, an empty list matches everything.
+func (ev Event) Matches(ops []Op, types []Type) bool {
+	if len(ops) != 0 {
+		var found bool
+		for _, op := range ops {
+			if op == ev.Op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(types) != 0 {
+		var found bool
+		for _, typ := range types {
+			if typ == ev.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// RawEvent is an event along with the whole frame it's decoded from.
+type RawEvent struct {
+	Event
+
+	// Raw is the frame as read from the control device, since linux 5.11
+	// it's struct rfkill_event_ext with hard_block_reasons appended,
+	// older kernels send only struct rfkill_event.
+	Raw []byte
+}
+
+// Filter is an events predicate, it reports whether ev is wanted.
+type Filter func(ev Event) bool
+
+// ByOp returns a filter matching events with any of the given ops.
+func ByOp(ops ...Op) Filter {
+	return func(ev Event) bool {
+		return ev.Matches(ops, nil)
+	}
+}
+
+// ByType returns a filter matching events with any of the given types.
+func ByType(types ...Type) Filter {
+	return func(ev Event) bool {
+		return ev.Matches(nil, types)
+	}
+}
+
+// And returns a filter matching events all of fs match.
+func And(fs ...Filter) Filter {
+	return func(ev Event) bool {
+		for _, fn := range fs {
+			if !fn(ev) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a filter matching events any of fs matches.
+func Or(fs ...Filter) Filter {
+	return func(ev Event) bool {
+		for _, fn := range fs {
+			if fn(ev) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TimedEvent is an event with the time it was received at.
+type TimedEvent struct {
+	Event
+
+	// Time the event was read from the control device.
+	Time time.Time
+}
+
+// jsonEvent is the JSON representation of Event.
+type jsonEvent struct {
+	Idx  uint32 `json:"idx"`
+	Type Type   `json:"type"`
+	Op   Op     `json:"op"`
+	Soft bool   `json:"soft"`
+	Hard bool   `json:"hard"`
+}
+
+// MarshalJSON implements json.Marshaler, type and op are encoded
+// as their names and block states as booleans.
+func (ev Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonEvent{
+		Idx:  ev.Idx,
+		Type: ev.Type,
+		Op:   ev.Op,
+		Soft: ev.Soft != 0,
+		Hard: ev.Hard != 0,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (ev *Event) UnmarshalJSON(b []byte) error {
+	var v jsonEvent
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*ev = Event{
+		Idx:  v.Idx,
+		Type: v.Type,
+		Op:   v.Op,
+		Soft: softState(v.Soft),
+		Hard: softState(v.Hard),
+	}
+	return nil
+}
+
+func softState(block bool) uint8 {
+	if block {
+		return 1
+	}
+	return 0
+}
+
+// validate checks that op and type of the event are known to the kernel
+// and that it doesn't try to change the read-only hard block state.
+func validate(ev Event) error {
+	if !ev.Op.Valid() {
+		return fmt.Errorf("rfkill: unknown op %d", ev.Op)
+	}
+	if !ev.Type.Valid() {
+		return fmt.Errorf("rfkill: unknown type %d", ev.Type)
+	}
+	if ev.Hard != 0 {
+		return errors.New("rfkill: hard block state is read-only")
+	}
+	return nil
+}
+
+// multiError is a list of errors occurred during a batch operation.
+type multiError []error
+
+func (e multiError) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Is reports whether any of the errors matches target, errors.Is
+// inspects multiple wrapped errors by itself only since go1.20.
+func (e multiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target like errors.As.
+func (e multiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap makes errors.Is and errors.As inspect all errors since go1.20.
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return multiError(errs)
+	}
+}
+
+// WatchStats are counters of events read by a watcher.
+type WatchStats struct {
+	// Total is number of all read events.
+	Total uint64
+
+	// Filtered is number of events dropped by the watcher's filters.
+	Filtered uint64
+
+	// Ops is number of read events per op.
+	Ops map[Op]uint64
+
+	// Types is number of read events per type.
+	Types map[Type]uint64
+}
+
+// WatchOption is a watcher configuration option.
+type WatchOption func(o *watchOptions)
+
+type watchOptions struct {
+	ops        []Op
+	types      []Type
+	buffer     int
+	file       string
+	timestamps bool
+	idxs       []uint32
+	retries    int
+	backoff    time.Duration
+	coalesce   time.Duration
+	into       chan<- Event
+	initial    bool
+	errors     bool
+	filter     Filter
+	idle       time.Duration
+	logger     func(ev Event, delivered bool)
+}
+
+// WithOps makes the watcher to deliver only events with the given ops.
+func WithOps(ops ...Op) WatchOption {
+	return func(o *watchOptions) {
+		o.ops = append(o.ops, ops...)
+	}
+}
+
+// WithTypes makes the watcher to deliver only events with the given types.
+func WithTypes(types ...Type) WatchOption {
+	return func(o *watchOptions) {
+		o.types = append(o.types, types...)
+	}
+}
+
+// WithIdx makes the watcher to deliver only events of the named devices,
+// since zero is a valid idx only calling it without arguments disables the filter.
+func WithIdx(idxs ...uint32) WatchOption {
+	return func(o *watchOptions) {
+		o.idxs = append(o.idxs, idxs...)
+	}
+}
+
+// WithBuffer sets size of the events channel so bursts of events
+// are absorbed while the consumer is busy.
+//
+// Events are never dropped, when the buffer is full
+// the watcher waits until the consumer catches up.
+func WithBuffer(n int) WatchOption {
+	return func(o *watchOptions) {
+		o.buffer = n
+	}
+}
+
+// WithFile makes the watcher to read events from the named
+// control device instead of /dev/rfkill.
+func WithFile(name string) WatchOption {
+	return func(o *watchOptions) {
+		o.file = name
+	}
+}
+
+// WithTimestamps makes the watcher to deliver events along with
+// the time they're read from the control device to Watcher.Timed instead of C.
+func WithTimestamps() WatchOption {
+	return func(o *watchOptions) {
+		o.timestamps = true
+	}
+}
+
+// WithReconnect makes the watcher to reopen the control device when reading
+// from it fails, e.g. when it disappears and reappears due to udev churn.
+//
+// Up to retries attempts are made for every failure, the delay before
+// the first one is backoff and it doubles after every next attempt.
+// When all attempts fail the stream is closed and Err reports the last error.
+//
+// After reopening the kernel reports all registered devices as OpAdd events again.
+func WithReconnect(retries int, backoff time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.retries = retries
+		o.backoff = backoff
+	}
+}
+
+// WithCoalesce makes the watcher to hold every event for the given window
+// before delivering it and drop identical events received meanwhile,
+// a different event flushes the held one immediately.
+func WithCoalesce(window time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.coalesce = window
+	}
+}
+
+// WithInitialState makes the watcher to deliver OpAdd events of all devices
+// registered at the moment it's started even when WithOps filters them out,
+// the type and idx filters still apply.
+//
+// The kernel queues the OpAdd events on the same descriptor live events
+// are read from, so they're always delivered first and no event happening
+// in between is missed or duplicated. Without ops filters the events
+// are delivered anyway and the option changes nothing.
+func WithInitialState() WatchOption {
+	return func(o *watchOptions) {
+		o.initial = true
+	}
+}
+
+// WithErrors makes the watcher to deliver non-fatal errors to Watcher.Errors
+// without closing the events stream, fatal ones still close both streams.
+//
+// Errors are never dropped, so the channel has to be received
+// from along with events, otherwise the watcher blocks.
+func WithErrors() WatchOption {
+	return func(o *watchOptions) {
+		o.errors = true
+	}
+}
+
+// WithFilter makes the watcher to deliver only events fn returns true for,
+// it's applied along with the other filters in the watcher's goroutine.
+func WithFilter(fn Filter) WatchOption {
+	return func(o *watchOptions) {
+		o.filter = fn
+	}
+}
+
+// WithIdleTimeout makes the watcher to close the stream with ErrIdleTimeout
+// when no event is delivered within the timeout, every delivered event
+// restarts it, zero disables the timeout.
+func WithIdleTimeout(timeout time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.idle = timeout
+	}
+}
+
+// WithLogger makes the watcher to call fn for every event read from
+// the control device reporting whether it passed the filters, so it's
+// seen which events the kernel sends and which of them are delivered.
+//
+// fn is called in the watcher's goroutine, so it has to be fast.
+func WithLogger(fn func(ev Event, delivered bool)) WatchOption {
+	return func(o *watchOptions) {
+		o.logger = fn
+	}
+}
+
+// match reports whether ev passes the configured filters,
+// empty filters match everything.
+func (o *watchOptions) match(ev Event) bool {
+	return ev.Matches(o.ops, nil) && o.matchDevice(ev) && (o.filter == nil || o.filter(ev))
+}
+
+// matchDevice is like match but ignores the ops filter.
+func (o *watchOptions) matchDevice(ev Event) bool {
+	if !ev.Matches(nil, o.types) {
+		return false
+	}
+	if len(o.idxs) != 0 {
+		var found bool
+		for _, idx := range o.idxs {
+			if idx == ev.Idx {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrClosed denotes closed watcher.
+var ErrClosed = errors.New("rfkill: closed")
+
+// ErrDeviceClosed is reported by Watcher.Err when the control device
+// stops delivering events, i.e. reading it hits EOF, without the watcher
+// being closed by the caller.
+var ErrDeviceClosed = errors.New("rfkill: control device closed")
+
+// ErrIdleTimeout is reported by Watcher.Err when the watcher is closed
+// because no events are delivered for the time set with WithIdleTimeout.
+var ErrIdleTimeout = errors.New("rfkill: idle timeout")
+
+// ErrTruncatedEvent denotes a partially read event frame,
+// such frames are skipped and reading continues with the next one.
+var ErrTruncatedEvent = errors.New("rfkill: truncated event")
+
+// ErrStopIteration can be returned by Each, EachDevice and Notify
+// callbacks to stop iterating, it's never returned to the caller.
+var ErrStopIteration = errors.New("rfkill: stop iteration")
+
+// ErrUnsupported is returned by all functions on platforms other than linux.
+var ErrUnsupported = errors.New("rfkill: unsupported platform")
@@ -0,0 +1,197 @@
+//+build linux
+
+package rfkill
+
+import (
+	"context"
+	"sort"
+)
+
+// WaitForType waits until a device of the given type is registered
+// and returns its OpAdd event, TypeAll matches any device.
+//
+// Already registered devices are considered as well, because the kernel
+// reports them as OpAdd events first when the control device is opened.
+// When ctx is done before that ctx.Err() is returned.
+func WaitForType(ctx context.Context, typ Type) (Event, error) {
+	opts := []WatchOption{WithOps(OpAdd)}
+	if typ != TypeAll {
+		opts = append(opts, WithTypes(typ))
+	}
+	return waitFor(ctx, opts...)
+}
+
+// WaitForIdx waits for the first event of the named device idx,
+// if ops is not empty only events with the given ops are considered.
+//
+// Note that the kernel reports registered devices as OpAdd events
+// right after the control device is opened, so to confirm a change
+// wait for OpChange and start waiting before the change is requested.
+func WaitForIdx(ctx context.Context, idx uint32, ops ...Op) (Event, error) {
+	return waitFor(ctx, WithIdx(idx), WithOps(ops...))
+}
+
+// waitFor returns the first event delivered by a watcher with the given options.
+func waitFor(ctx context.Context, opts ...WatchOption) (Event, error) {
+	w, err := NewWatcher(ctx, opts...)
+	if err != nil {
+		return Event{}, err
+	}
+	defer w.Close()
+
+	ev, ok := <-w.C()
+	if !ok {
+		return Event{}, w.Err()
+	}
+	return ev, nil
+}
+
+// BlockType soft blocks or unblocks all currently registered devices of
+// the given type one by one, TypeAll matches any device, and waits until
+// the kernel confirms every change, the final states of the devices
+// taken from the confirming events are returned sorted by idx.
+//
+// Unlike BlockByType it's synchronous, ctx bounds the waiting and
+// when it's done before all changes are confirmed ctx.Err() is returned.
+// Devices already in the requested state are not waited for,
+// because the kernel doesn't report changes that change nothing,
+// and devices removed while waiting are left out of the result.
+//
+// ctx should carry a deadline, otherwise a confirmation the kernel
+// never sends, e.g. when a driver fails to apply the change,
+// makes it wait forever.
+func BlockType(ctx context.Context, typ Type, block bool) ([]Device, error) {
+	// start watching before blocking, so no confirmation is missed
+	opts := []WatchOption{WithOps(OpChange, OpDel)}
+	if typ != TypeAll {
+		opts = append(opts, WithTypes(typ))
+	}
+	w, err := NewWatcher(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	devs, err := ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	idxs := make([]uint32, 0, len(devs))
+	pending := map[uint32]*Device{}
+	for _, dev := range devs {
+		if typ != TypeAll && dev.Type != typ {
+			continue
+		}
+		devs[n] = dev
+		idxs = append(idxs, dev.Idx)
+		if dev.Soft != block {
+			pending[dev.Idx] = &devs[n]
+		}
+		n++
+	}
+	devs = devs[:n]
+	if err = BlockIndices(block, idxs...); err != nil {
+		return nil, err
+	}
+
+	removed := map[uint32]bool{}
+	for len(pending) != 0 {
+		ev, ok := <-w.C()
+		if !ok {
+			return nil, w.Err()
+		}
+		if ev.Op == OpDel {
+			removed[ev.Idx] = true
+			delete(pending, ev.Idx)
+			continue
+		}
+		dev, ok := pending[ev.Idx]
+		if !ok || dev.Type != ev.Type || (ev.Soft != 0) != block {
+			continue
+		}
+		dev.Soft = ev.Soft != 0
+		dev.Hard = ev.Hard != 0
+		delete(pending, ev.Idx)
+	}
+
+	n = 0
+	for _, dev := range devs {
+		if !removed[dev.Idx] {
+			devs[n] = dev
+			n++
+		}
+	}
+	return devs[:n], nil
+}
+
+// WaitAllBlocked soft blocks or unblocks all devices at once with BlockAll
+// and waits until the kernel confirms that every currently registered
+// device is in the requested soft state, it's the verified BlockAll.
+//
+// Unblocking doesn't make hard blocked devices usable, so when any of them
+// is hard blocked after the soft states are confirmed HardBlockedError
+// listing them is returned. ctx bounds the waiting and when it's done
+// before all changes are confirmed ctx.Err() is returned, like with
+// BlockType it should carry a deadline. Devices removed while waiting
+// are not waited for and not reported.
+func WaitAllBlocked(ctx context.Context, block bool) error {
+	// start watching before blocking, so no confirmation is missed
+	w, err := NewWatcher(ctx, WithOps(OpChange, OpDel))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	devs, err := ListDevices()
+	if err != nil {
+		return err
+	}
+	hard := map[uint32]bool{}
+	pending := map[uint32]bool{}
+	for _, dev := range devs {
+		hard[dev.Idx] = dev.Hard
+		if dev.Soft != block {
+			pending[dev.Idx] = true
+		}
+	}
+	if err = BlockAll(block); err != nil {
+		return err
+	}
+
+	for len(pending) != 0 {
+		ev, ok := <-w.C()
+		if !ok {
+			return w.Err()
+		}
+		if _, ok = hard[ev.Idx]; !ok {
+			continue // registered after listing
+		}
+		if ev.Op == OpDel {
+			delete(hard, ev.Idx)
+			delete(pending, ev.Idx)
+			continue
+		}
+		hard[ev.Idx] = ev.Hard != 0
+		if (ev.Soft != 0) == block {
+			delete(pending, ev.Idx)
+		}
+	}
+
+	if block {
+		return nil
+	}
+	var idxs []uint32
+	for idx, ok := range hard {
+		if ok {
+			idxs = append(idxs, idx)
+		}
+	}
+	if len(idxs) != 0 {
+		sort.Slice(idxs, func(i, j int) bool {
+			return idxs[i] < idxs[j]
+		})
+		return &HardBlockedError{Idxs: idxs}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+//+build linux
+
+package rfkill
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitForType(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		for _, ev := range []Event{
+			{Idx: 0, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeBluetooth, Op: OpChange},
+			{Idx: 1, Type: TypeBluetooth, Op: OpAdd},
+		} {
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ev, err := WaitForType(context.Background(), TypeBluetooth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (Event{Idx: 1, Type: TypeBluetooth, Op: OpAdd}); ev != want {
+			t.Fatalf("WaitForType = %#v, want %#v", ev, want)
+		}
+	})
+}
+
+func TestWaitForTypeTimeout(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := WaitForType(ctx, TypeNFC); err != context.DeadlineExceeded {
+			t.Fatalf("WaitForType err = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestWaitForIdx(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		for _, ev := range []Event{
+			{Idx: 2, Type: TypeWLAN, Op: OpAdd},
+			{Idx: 1, Type: TypeWLAN, Op: OpChange},
+			{Idx: 2, Type: TypeWLAN, Op: OpChange, Soft: 1},
+		} {
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ev, err := WaitForIdx(context.Background(), 2, OpChange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (Event{Idx: 2, Type: TypeWLAN, Op: OpChange, Soft: 1}); ev != want {
+			t.Fatalf("WaitForIdx = %#v, want %#v", ev, want)
+		}
+	})
+}
+
+func TestBlockType(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			for _, dev := range []Device{
+				{Idx: 0, Name: "phy0", Type: TypeWLAN},
+				{Idx: 1, Name: "hci0", Type: TypeBluetooth},
+				{Idx: 2, Name: "phy2", Type: TypeWLAN, Soft: true},
+			} {
+				writeDevice(t, dir, dev)
+			}
+			// the kernel's confirmation of the change,
+			// idx 2 is not reported since it's already blocked
+			ev := Event{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1, Hard: 1}
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+
+			devs, err := BlockType(context.Background(), TypeWLAN, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Device{
+				{Idx: 0, Name: "phy0", Type: TypeWLAN, Soft: true, Hard: true},
+				{Idx: 2, Name: "phy2", Type: TypeWLAN, Soft: true},
+			}
+			if !reflect.DeepEqual(devs, want) {
+				t.Fatalf("BlockType = %v, want %v", devs, want)
+			}
+		})
+	})
+}
+
+func TestBlockTypeRemoved(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+			writeDevice(t, dir, Device{Idx: 1, Name: "phy1", Type: TypeWLAN})
+			// idx 1 is unregistered before its change is confirmed
+			for _, ev := range []Event{
+				{Idx: 1, Type: TypeWLAN, Op: OpDel},
+				{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1},
+			} {
+				if err := binary.Write(f, endianness, ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			devs, err := BlockType(ctx, TypeWLAN, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Device{{Idx: 0, Name: "phy0", Type: TypeWLAN, Soft: true}}
+			if !reflect.DeepEqual(devs, want) {
+				t.Fatalf("BlockType = %v, want %v", devs, want)
+			}
+		})
+	})
+}
+
+func TestBlockTypeTimeout(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if _, err := BlockType(ctx, TypeAll, true); err != context.DeadlineExceeded {
+				t.Fatalf("BlockType err = %v, want %v", err, context.DeadlineExceeded)
+			}
+		})
+	})
+}
+
+func TestWaitAllBlocked(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			for _, dev := range []Device{
+				{Idx: 0, Name: "phy0", Type: TypeWLAN, Soft: true},
+				{Idx: 1, Name: "hci0", Type: TypeBluetooth, Soft: true},
+				{Idx: 2, Name: "phy2", Type: TypeWLAN, Hard: true},
+				{Idx: 3, Name: "phy3", Type: TypeWLAN},
+			} {
+				writeDevice(t, dir, dev)
+			}
+			// idx 1 gets hard blocked while it's being unblocked,
+			// idxs 2 and 3 are not reported since they're already unblocked
+			for _, ev := range []Event{
+				{Idx: 0, Type: TypeWLAN, Op: OpChange},
+				{Idx: 1, Type: TypeBluetooth, Op: OpChange, Hard: 1},
+			} {
+				if err := binary.Write(f, endianness, ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := WaitAllBlocked(context.Background(), false)
+			var herr *HardBlockedError
+			if !errors.As(err, &herr) {
+				t.Fatalf("WaitAllBlocked err = %v, want a HardBlockedError", err)
+			}
+			if want := []uint32{1, 2}; !reflect.DeepEqual(herr.Idxs, want) {
+				t.Fatalf("HardBlockedError.Idxs = %v, want %v", herr.Idxs, want)
+			}
+			if want := "rfkill: devices are still hard blocked: 1, 2"; err.Error() != want {
+				t.Fatalf("WaitAllBlocked err = %q, want %q", err, want)
+			}
+		})
+	})
+}
+
+func TestWaitAllBlockedBlock(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN, Hard: true})
+			writeDevice(t, dir, Device{Idx: 1, Name: "hci0", Type: TypeBluetooth, Soft: true})
+			ev := Event{Idx: 0, Type: TypeWLAN, Op: OpChange, Soft: 1, Hard: 1}
+			if err := binary.Write(f, endianness, ev); err != nil {
+				t.Fatal(err)
+			}
+			// hard blocked devices are fine when blocking
+			if err := WaitAllBlocked(context.Background(), true); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+}
+
+func TestWaitAllBlockedRemoved(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN, Soft: true})
+			writeDevice(t, dir, Device{Idx: 1, Name: "hci0", Type: TypeBluetooth, Soft: true, Hard: true})
+			// the hard blocked idx 1 vanishes before its change is confirmed
+			for _, ev := range []Event{
+				{Idx: 1, Type: TypeBluetooth, Op: OpDel, Soft: 1, Hard: 1},
+				{Idx: 0, Type: TypeWLAN, Op: OpChange},
+			} {
+				if err := binary.Write(f, endianness, ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := WaitAllBlocked(ctx, false); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+}
+
+func TestWaitAllBlockedTimeout(t *testing.T) {
+	withControlFifo(t, func(f *os.File) {
+		withSysfs(t, func(dir string) {
+			writeDevice(t, dir, Device{Idx: 0, Name: "phy0", Type: TypeWLAN})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if err := WaitAllBlocked(ctx, true); err != context.DeadlineExceeded {
+				t.Fatalf("WaitAllBlocked err = %v, want %v", err, context.DeadlineExceeded)
+			}
+		})
+	})
+}